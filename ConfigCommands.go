@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Print the effective config including env overrides with masked secrets
+func printConfig() error {
+	b, err := yaml.Marshal(config.Masked())
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(string(b))
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/DataManager-Go/DataManagerServer/constants"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	"github.com/alecthomas/kingpin"
+	"github.com/sbani/go-humanizer/units"
+)
+
+// Flags to set the values of a role. Only
+// flags set by the user are applied
+type roleFlags struct {
+	permissions                                *string
+	require2FA                                 *bool
+	maxURLContentSize, maxUploadFileSize       *int64
+	permissionsSet, require2FASet              bool
+	maxURLContentSizeSet, maxUploadFileSizeSet bool
+}
+
+// Register the role flags for cmd
+func newRoleFlags(cmd *kingpin.CmdClause) *roleFlags {
+	flags := &roleFlags{}
+	flags.permissions = cmd.Flag("permissions", "Comma separated list of granted permissions or 'all'. Replaces existing permissions").
+		HintOptions(append(models.PermissionNames(), models.PermissionAll)...).IsSetByUser(&flags.permissionsSet).String()
+	flags.require2FA = cmd.Flag("require-2fa", "Require two-factor authentication").IsSetByUser(&flags.require2FASet).Bool()
+	flags.maxURLContentSize = cmd.Flag("max-url-size", "Max size of files uploaded from an URL. -1 for unlimited").IsSetByUser(&flags.maxURLContentSizeSet).Int64()
+	flags.maxUploadFileSize = cmd.Flag("max-upload-size", "Max size of uploaded files. -1 for unlimited").IsSetByUser(&flags.maxUploadFileSizeSet).Int64()
+	return flags
+}
+
+// Apply all flags set by the user to role
+func (flags *roleFlags) apply(role *models.Role) error {
+	if flags.permissionsSet {
+		permissions, err := models.ParsePermissions(strings.Split(*flags.permissions, ","))
+		if err != nil {
+			return err
+		}
+
+		role.Permissions = permissions
+	}
+	if flags.require2FASet {
+		role.Require2FA = *flags.require2FA
+	}
+	if flags.maxURLContentSizeSet {
+		role.MaxURLcontentSize = *flags.maxURLContentSize
+	}
+	if flags.maxUploadFileSizeSet {
+		role.MaxUploadFileSize = *flags.maxUploadFileSize
+	}
+
+	return nil
+}
+
+// List all roles
+func listRoles() error {
+	roles, err := models.GetAllRoles(db)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tName\tMax upload\tMax URL\t2FA\tUsers\tPermissions")
+
+	for i := range roles {
+		users, err := roles[i].GetUserCount(db)
+		if err != nil {
+			return err
+		}
+
+		name := roles[i].RoleName
+		if roles[i].ID == config.Server.Roles.DefaultRole {
+			name += " (default)"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%t\t%d\t%s\n",
+			roles[i].ID, name, formatLimit(roles[i].MaxUploadFileSize), formatLimit(roles[i].MaxURLcontentSize),
+			roles[i].Require2FA, users, roles[i].Permissions)
+	}
+
+	return w.Flush()
+}
+
+// Create a new role
+func createRole(name string, flags *roleFlags) error {
+	role := models.NewRole(name)
+	if err := flags.apply(&role); err != nil {
+		return err
+	}
+
+	if err := role.Validate(config); err != nil {
+		return err
+	}
+
+	if err := role.Create(db); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s created role '%s' with ID %d\n", constants.GreenSuccessfully, role.RoleName, role.ID)
+	return nil
+}
+
+// Edit an existing role. Running servers
+// pick up the changes within a few seconds
+func editRole(id uint, name string, flags *roleFlags) error {
+	role, err := models.FindRole(db, id)
+	if err != nil {
+		return err
+	}
+
+	if len(name) > 0 {
+		role.RoleName = name
+	}
+	if err = flags.apply(role); err != nil {
+		return err
+	}
+
+	if err = role.Validate(config); err != nil {
+		return err
+	}
+
+	if err = role.Save(db); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s updated role '%s'\n", constants.GreenSuccessfully, role.RoleName)
+	return nil
+}
+
+// Delete a role
+func deleteRole(id uint) error {
+	role, err := models.FindRole(db, id)
+	if err != nil {
+		return err
+	}
+
+	if err = role.Delete(db, config); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s deleted role '%s'\n", constants.GreenSuccessfully, role.RoleName)
+	return nil
+}
+
+// Format a role size limit
+func formatLimit(limit int64) string {
+	if limit < 0 {
+		return "unlimited"
+	}
+
+	return units.BinarySuffix(float64(limit))
+}
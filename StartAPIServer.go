@@ -7,27 +7,44 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/DataManager-Go/DataManagerServer/handlers"
+	"github.com/DataManager-Go/DataManagerServer/models"
 	"github.com/DataManager-Go/DataManagerServer/services"
 	"gorm.io/gorm"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// Time given to running shred jobs on shutdown
+const shredWaitTimeout = 5 * time.Second
+
 // Services
 var (
 	apiService     *services.APIService     // Handle endpoints
 	cleanupService *services.CleanupService // Cleanup db stuff
+	webhookService *services.WebhookService // Deliver webhooks
 )
 
 func startAPI() {
 	log.Info("Starting version " + version)
 
+	// Stops the background services
+	ctx, stopServices := context.WithCancel(context.Background())
+
 	// Create and start required services
 	apiService = services.NewAPIService(config, db)
 	apiService.Start()
 
-	cleanupService = services.NewClienupService(config, db)
-	cleanupService.Start()
+	cleanupService = services.NewClienupService(models.LiveConfig, db)
+	cleanupService.Start(ctx)
+
+	webhookService = services.NewWebhookService(models.LiveConfig, db)
+	webhookService.Start(ctx)
+
+	// Continue shredding files the last run didn't finish
+	if err := models.ResumeShredJobs(db); err != nil {
+		log.Error(err)
+	}
 
 	if config.Webserver.Profiling {
 		log.Info("Starting in profiling mode")
@@ -36,37 +53,69 @@ func startAPI() {
 	// Startup done
 	log.Info("Startup completed")
 
-	awaitExit(apiService, db)
+	go reloadOnHangup()
+
+	awaitExit(apiService, db, stopServices)
+}
+
+// Reload the config on SIGHUP
+func reloadOnHangup() {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGHUP)
+
+	for range signalChan {
+		if _, err := models.ReloadConfig(); err != nil {
+			log.Errorf("Can't reload config: %s", err)
+		}
+	}
 }
 
 // Shutdown server gracefully
-func awaitExit(httpServer *services.APIService, db *gorm.DB) {
+func awaitExit(httpServer *services.APIService, db *gorm.DB, stopServices context.CancelFunc) {
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGINT, os.Interrupt, syscall.SIGKILL, syscall.SIGTERM)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 
 	// await os signal
 	<-signalChan
 
+	log.Info("Shutting down server")
+
+	// Report not ready and end long running requests
+	handlers.SetShuttingDown()
+
+	// Keep accepting requests until load balancers noticed
+	// the server isn't ready. Another signal skips the delay
+	if delay := config.Webserver.ShutdownReadinessDelay; delay > 0 {
+		log.Infof("Waiting %s before stopping to accept requests", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-signalChan:
+		}
+	}
+
 	// Create a deadline for the await
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	ctx, cancel := context.WithTimeout(context.Background(), config.Webserver.ShutdownTimeout)
 	defer cancel()
 
-	log.Info("Shutting down server")
+	// Stop accepting requests and wait for running uploads
+	httpServer.Shutdown(ctx)
 
-	if httpServer.HTTPServer != nil {
-		err := httpServer.HTTPServer.Shutdown(ctx)
-		if err != nil {
-			log.Warn(err)
-		}
-		log.Info("HTTP server shutdown complete")
+	// Stop background services
+	stopServices()
+	cleanupService.Wait()
+	webhookService.Wait()
+
+	// Unfinished shred jobs are resumed on the next start
+	shredCtx, cancelShred := context.WithTimeout(context.Background(), shredWaitTimeout)
+	defer cancelShred()
+
+	if !models.WaitForShredJobs(shredCtx) {
+		log.Warn("Shredding files didn't finish in time. Continuing on the next start")
 	}
 
-	if httpServer.HTTPTLSServer != nil {
-		err := httpServer.HTTPTLSServer.Shutdown(ctx)
-		if err != nil {
-			log.Warn(err)
-		}
-		log.Info("HTTPs server shutdown complete")
+	if sqlDB, err := db.DB(); err == nil {
+		LogError(sqlDB.Close())
 	}
 
 	log.Info("Shutting down complete")
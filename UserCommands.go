@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/DataManager-Go/DataManagerServer/constants"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	"github.com/sbani/go-humanizer/units"
+	"golang.org/x/term"
+	"gorm.io/gorm"
+)
+
+// Create a new user
+func createUser(username, password string, roleID uint) error {
+	password, err := getPassword(password)
+	if err != nil {
+		return err
+	}
+
+	user := models.User{
+		Username: username,
+		Password: password,
+		RoleID:   roleID,
+	}
+
+	if err = user.Register(db, config); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s created user '%s'\n", constants.GreenSuccessfully, user.GetUsername())
+	return nil
+}
+
+// Assign a role to a user
+func setUserRole(username string, roleID uint) error {
+	user, err := findUser(username)
+	if err != nil {
+		return err
+	}
+
+	role, err := models.FindRole(db, roleID)
+	if err != nil {
+		return err
+	}
+
+	if err = user.SetRole(db, role); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s set role of '%s' to '%s'\n", constants.GreenSuccessfully, user.Username, role.RoleName)
+	return nil
+}
+
+// Reset the password of a user and revoke its sessions
+func resetUserPassword(username, password string) error {
+	user, err := findUser(username)
+	if err != nil {
+		return err
+	}
+
+	if password, err = getPassword(password); err != nil {
+		return err
+	}
+
+	if err = user.UpdatePassword(db, password, config); err != nil {
+		return err
+	}
+
+	if _, err = models.RevokeUserSessions(db, user.ID, 0); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s reset password of '%s'\n", constants.GreenSuccessfully, user.Username)
+	return nil
+}
+
+// Revoke all sessions of a user
+func logoutUser(username string) error {
+	user, err := findUser(username)
+	if err != nil {
+		return err
+	}
+
+	count, err := models.RevokeUserSessions(db, user.ID, 0)
+	if err != nil {
+		return err
+	}
+
+	// Running servers cache sessions for a few seconds
+	fmt.Printf("%s revoked %d sessions of '%s'\n", constants.GreenSuccessfully, count, user.Username)
+	return nil
+}
+
+// Export all data of a user into a zip archive
+func exportUser(username, output string) error {
+	user, err := findUser(username)
+	if err != nil {
+		return err
+	}
+
+	if len(output) == 0 {
+		output = user.GetUsername() + "_export.zip"
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err = user.ExportData(db, config, f); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s exported '%s' to %s\n", constants.GreenSuccessfully, user.Username, output)
+	return nil
+}
+
+// List all users
+func listUsers() error {
+	users, err := models.GetAllUsers(db)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUsername\tRole\tDisabled\t2FA\tCreated")
+
+	for _, user := range users {
+		roleName := ""
+		if user.Role != nil {
+			roleName = user.Role.RoleName
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%t\t%t\t%s\n", user.ID, user.Username, roleName, user.Disabled, user.HasTOTP(), user.CreatedAt.Format("2006-01-02 15:04"))
+	}
+
+	return w.Flush()
+}
+
+// List all namespaces including their usage
+func listNamespaces(username string) error {
+	usage, err := models.GetNamespaceUsage(db)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tName\tOwner\tFiles\tSize")
+
+	for _, namespace := range usage {
+		if len(username) > 0 && namespace.Owner != strings.ToLower(username) {
+			continue
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", namespace.ID, namespace.Name, namespace.Owner, namespace.FileCount, units.BinarySuffix(float64(namespace.Size)))
+	}
+
+	return w.Flush()
+}
+
+// Show the storage usage per user
+func showStorageUsage() error {
+	usage, err := models.GetNamespaceUsage(db)
+	if err != nil {
+		return err
+	}
+
+	// Sum up namespaces per user
+	var owners []string
+	files := make(map[string]int64)
+	sizes := make(map[string]int64)
+	var totalFiles, totalSize int64
+
+	for _, namespace := range usage {
+		if _, ok := sizes[namespace.Owner]; !ok {
+			owners = append(owners, namespace.Owner)
+		}
+
+		files[namespace.Owner] += namespace.FileCount
+		sizes[namespace.Owner] += namespace.Size
+		totalFiles += namespace.FileCount
+		totalSize += namespace.Size
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "User\tFiles\tSize")
+
+	for _, owner := range owners {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", owner, files[owner], units.BinarySuffix(float64(sizes[owner])))
+	}
+
+	fmt.Fprintf(w, "\t\t\nTotal\t%d\t%s\n", totalFiles, units.BinarySuffix(float64(totalSize)))
+	return w.Flush()
+}
+
+// Find a user by its name
+func findUser(username string) (*models.User, error) {
+	user, err := models.FindUser(db, username)
+	if err == gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("user '%s' not found", username)
+	}
+
+	return user, err
+}
+
+// Return password or prompt for it if empty
+func getPassword(password string) (string, error) {
+	if len(password) > 0 {
+		return password, nil
+	}
+
+	fmt.Print("Password: ")
+
+	// Don't echo passwords typed into a terminal
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+
+		password = string(pass)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && len(line) == 0 {
+			return "", err
+		}
+
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if len(password) == 0 {
+		return "", errors.New("password can't be empty")
+	}
+
+	return password, nil
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Header containing the ID of a request
+	requestIDHeader = "X-Request-ID"
+
+	// Max length of request IDs passed by clients
+	maxRequestIDLength = 64
+)
+
+// Writes one JSON entry per handled request
+var accessLog = log.New()
+
+// Set up the access log. Logs to stdout if no file is configured
+func initAccessLog(config *models.Config) error {
+	accessLog.SetFormatter(&log.JSONFormatter{})
+
+	if len(config.Webserver.AccessLogFile) == 0 {
+		accessLog.SetOutput(os.Stdout)
+		return nil
+	}
+
+	f, err := os.OpenFile(config.Webserver.AccessLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+
+	accessLog.SetOutput(f)
+	return nil
+}
+
+// Returns the request ID passed by the client or a new one
+func getRequestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); isValidRequestID(id) {
+		return id
+	}
+
+	buff := make([]byte, 12)
+	if _, err := rand.Read(buff); err != nil {
+		log.Error(err)
+	}
+
+	return hex.EncodeToString(buff)
+}
+
+// Only accept IDs which can't break log lines
+func isValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && !strings.ContainsRune("-_.:", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Counts the bytes read from a request body
+type bodyCounter struct {
+	io.ReadCloser
+	size int64
+}
+
+func (counter *bodyCounter) Read(p []byte) (int, error) {
+	n, err := counter.ReadCloser.Read(p)
+	counter.size += int64(n)
+	return n, err
+}
+
+// Write the access log entry of a handled request
+func logAccess(handlerData *web.HandlerData, r *http.Request, w *statusRecorder, body *bodyCounter, requestID, route string, start time.Time) {
+	var userID uint
+	if handlerData.User != nil {
+		userID = handlerData.User.ID
+	}
+
+	accessLog.WithFields(log.Fields{
+		"requestID":  requestID,
+		"userID":     userID,
+		"route":      route,
+		"method":     r.Method,
+		"status":     w.getStatus(),
+		"bytesIn":    body.size,
+		"bytesOut":   w.size,
+		"durationMs": float64(time.Since(start).Microseconds()) / 1000,
+		"ip":         GetClientIP(handlerData.Config, r),
+	}).Info("request")
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	libdm "github.com/DataManager-Go/libdatamanager"
+)
+
+// PasswordChangeRequest request to change the password of a user
+type PasswordChangeRequest struct {
+	Password    string `json:"pass"`
+	NewPassword string `json:"newPass"`
+}
+
+// RenameRequest request to change the username
+type RenameRequest struct {
+	Password string `json:"pass"`
+	NewName  string `json:"newName"`
+}
+
+// RenameResponse response containing the new username and default namespace
+type RenameResponse struct {
+	Username  string `json:"username"`
+	Namespace string `json:"ns"`
+}
+
+// AccountDeleteRequest request to delete the account
+type AccountDeleteRequest struct {
+	Password string `json:"pass"`
+	OTP      string `json:"otp,omitempty"`
+}
+
+// ChangePasswordHandler changes the password of the user
+// and revokes all sessions except the current one
+func ChangePasswordHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request PasswordChangeRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	if len(request.NewPassword) == 0 {
+		return RErrMissing.Prepend("New password")
+	}
+
+	user, err := reauthenticate(handlerData, w, r, request.Password, "", true)
+	if err != nil {
+		return err
+	}
+
+	if err = user.UpdatePassword(handlerData.Db, request.NewPassword, handlerData.Config); err != nil {
+		if err == models.ErrorExternalUser {
+			return RErrExternalUser
+		}
+
+		return err
+	}
+
+	if _, err = models.RevokeUserSessions(handlerData.Db, user.ID, handlerData.Session.ID); err != nil {
+		return err
+	}
+
+	handlerData.Log.Infof("User '%s' changed the password", user.Username)
+	audit(handlerData, r, models.UserAuditEntry(models.AuditPassword, user))
+
+	sendResponse(w, libdm.ResponseSuccess, "", nil)
+	return nil
+}
+
+// RenameHandler changes the username and the names
+// of the namespaces prefixed with the username
+func RenameHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request RenameRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	if len(request.NewName) == 0 {
+		return RErrMissing.Prepend("New name")
+	}
+
+	user, err := reauthenticate(handlerData, w, r, request.Password, "", true)
+	if err != nil {
+		return err
+	}
+
+	oldName := user.Username
+	err = user.Rename(handlerData.Db, handlerData.Config, request.NewName)
+	switch err {
+	case nil:
+	case models.ErrorUserAlreadyExists:
+		return RErrAlreadyExists.Prepend("User")
+	case models.ErrorExternalUser:
+		return RErrExternalUser
+	default:
+		return err
+	}
+
+	handlerData.Log.Infof("User '%s' renamed to '%s'", oldName, user.Username)
+	auditAs(handlerData, r, user, models.UserAuditEntry(models.AuditRename, user).WithChange(oldName, user.Username))
+
+	sendResponse(w, libdm.ResponseSuccess, "", RenameResponse{
+		Username:  user.Username,
+		Namespace: user.GetDefaultNamespaceName(),
+	})
+
+	return nil
+}
+
+// DeleteAccountHandler deletes the user including all of its files
+func DeleteAccountHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request AccountDeleteRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	user, err := reauthenticate(handlerData, w, r, request.Password, request.OTP, false)
+	if err != nil {
+		return err
+	}
+
+	if err = user.Delete(handlerData.Db, handlerData.Config); err != nil {
+		if err == models.ErrorLastAdmin {
+			return NewRequestError(err.Error(), http.StatusConflict)
+		}
+
+		return err
+	}
+
+	handlerData.Log.Infof("User '%s' deleted the account", user.Username)
+	audit(handlerData, r, models.UserAuditEntry(models.AuditDeleteUser, user))
+
+	sendResponse(w, libdm.ResponseSuccess, "", nil)
+	return nil
+}
+
+// Verify the password of the logged in user again.
+// The second factor is verified unless skipSecondFactor is set
+func reauthenticate(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request, password, otp string, skipSecondFactor bool) (*models.User, error) {
+	request := LoginRequest{OTP: otp}
+	request.Username = handlerData.User.Username
+	request.Password = password
+
+	if skipSecondFactor {
+		return authenticateCredentials(handlerData, w, r, request, true)
+	}
+
+	return authenticateCredentials(handlerData, w, r, request)
+}
+
+// ExportHandler sends a zip archive containing
+// all files and data stored about the user
+func ExportHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	fileName := fmt.Sprintf("%s_export_%s.zip", handlerData.User.GetUsername(), time.Now().Format("2006-01-02"))
+
+	w.Header().Set(libdm.HeaderContentType, "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+
+	if err := handlerData.User.ExportData(handlerData.Db, handlerData.Config, w); err != nil {
+		// The response has already been started
+		handlerData.LogError(err)
+		return nil
+	}
+
+	handlerData.Log.Infof("User '%s' exported the account data", handlerData.User.Username)
+	return nil
+}
@@ -0,0 +1,471 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	libdm "github.com/DataManager-Go/libdatamanager"
+	"github.com/JojiiOfficial/gaw"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// AdminUserRequest request to manage a user
+type AdminUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"pass,omitempty"`
+	RoleID   uint   `json:"role,omitempty"`
+}
+
+// AdminUserItem a user including its usage
+type AdminUserItem struct {
+	ID             uint      `json:"id"`
+	Username       string    `json:"username"`
+	RoleID         uint      `json:"roleID"`
+	Role           string    `json:"role"`
+	Disabled       bool      `json:"disabled"`
+	Source         string    `json:"source,omitempty"`
+	TOTPEnabled    bool      `json:"totp"`
+	CreatedAt      time.Time `json:"created"`
+	FileCount      int64     `json:"files"`
+	TotalFileSize  int64     `json:"size"`
+	NamespaceCount int64     `json:"namespaces"`
+	SessionCount   int       `json:"sessions"`
+}
+
+// AdminUserListResponse response containing all users
+type AdminUserListResponse struct {
+	Users []AdminUserItem `json:"users"`
+}
+
+// AdminRoleRequest request to manage a role. Unset
+// values are kept when updating a role
+type AdminRoleRequest struct {
+	ID                uint               `json:"id,omitempty"`
+	Name              *string            `json:"name,omitempty"`
+	Permissions       *models.Permission `json:"permissions,omitempty"`
+	MaxURLContentSize *int64             `json:"maxURLContentSize,omitempty"`
+	MaxUploadFileSize *int64             `json:"maxUploadFileSize,omitempty"`
+	Require2FA        *bool              `json:"require2fa,omitempty"`
+}
+
+// AdminRoleItem a role including the count of its users
+type AdminRoleItem struct {
+	ID                uint              `json:"id"`
+	Name              string            `json:"name"`
+	Permissions       models.Permission `json:"permissions"`
+	MaxURLContentSize int64             `json:"maxURLContentSize"`
+	MaxUploadFileSize int64             `json:"maxUploadFileSize"`
+	Require2FA        bool              `json:"require2fa"`
+	Default           bool              `json:"default"`
+	Users             int64             `json:"users"`
+}
+
+// AdminRoleListResponse response containing all roles
+type AdminRoleListResponse struct {
+	Roles []AdminRoleItem `json:"roles"`
+}
+
+// LockoutRequest request to clear the lockout of an IP and/or username
+type LockoutRequest struct {
+	IP       string `json:"ip,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// LockoutItem a locked IP or username
+type LockoutItem struct {
+	Subject     string    `json:"subject"`
+	Failures    uint      `json:"failures"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// LockoutListResponse response containing all active lockouts
+type LockoutListResponse struct {
+	Lockouts []LockoutItem `json:"lockouts"`
+}
+
+// AdminUserListHandler lists all users including their usage
+func AdminUserListHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	users, err := models.GetAllUsers(handlerData.Db)
+	if err != nil {
+		return err
+	}
+
+	response := AdminUserListResponse{
+		Users: make([]AdminUserItem, len(users)),
+	}
+
+	for i := range users {
+		item, err := adminUserItem(handlerData, &users[i])
+		if err != nil {
+			return err
+		}
+
+		response.Users[i] = *item
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", response)
+	return nil
+}
+
+// AdminUserHandler handler for user actions
+// (create/disable/enable/role/password/logout/delete)
+func AdminUserHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	action := mux.Vars(r)["action"]
+	if !gaw.IsInStringArray(action, []string{"create", "disable", "enable", "role", "password", "logout", "delete"}) {
+		return RErrBadRequest
+	}
+
+	var request AdminUserRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	if len(request.Username) == 0 {
+		return RErrMissing.Prepend("Username")
+	}
+
+	if action == "create" {
+		return adminCreateUser(handlerData, w, r, request)
+	}
+
+	user, err := models.FindUser(handlerData.Db, request.Username)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return RErrNotFound.Prepend("User")
+		}
+
+		return err
+	}
+
+	// Prevent admins from locking themselves out
+	if user.ID == handlerData.User.ID && gaw.IsInStringArray(action, []string{"disable", "role", "delete"}) {
+		return RErrNotAllowed.Append("for your own account")
+	}
+
+	entry := models.UserAuditEntry(models.AuditAdminUser.Sub(action), user)
+
+	switch action {
+	case "disable", "enable":
+		err = user.SetDisabled(handlerData.Db, action == "disable")
+	case "role":
+		var role *models.Role
+		if role, err = models.FindRole(handlerData.Db, request.RoleID); err == nil {
+			var oldRole string
+			if user.Role != nil {
+				oldRole = user.Role.RoleName
+			}
+
+			entry = entry.WithChange(oldRole, role.RoleName)
+			err = user.SetRole(handlerData.Db, role)
+		}
+	case "password":
+		if len(request.Password) == 0 {
+			return RErrMissing.Prepend("Password")
+		}
+
+		if err = user.UpdatePassword(handlerData.Db, request.Password, handlerData.Config); err == nil {
+			_, err = models.RevokeUserSessions(handlerData.Db, user.ID, 0)
+		}
+	case "logout":
+		_, err = models.RevokeUserSessions(handlerData.Db, user.ID, 0)
+	case "delete":
+		err = user.Delete(handlerData.Db, handlerData.Config)
+	}
+
+	if err == models.ErrorRoleNotFound {
+		return RErrNotFound.Prepend("Role")
+	} else if err == models.ErrorLastAdmin {
+		return NewRequestError(err.Error(), http.StatusConflict)
+	} else if err == models.ErrorExternalUser {
+		return RErrExternalUser
+	} else if err != nil {
+		return err
+	}
+
+	handlerData.Log.WithField("admin", handlerData.User.Username).Infof("Applied '%s' to user '%s'", action, user.Username)
+	audit(handlerData, r, entry)
+
+	sendResponse(w, libdm.ResponseSuccess, "", nil)
+	return nil
+}
+
+// Create a new user
+func adminCreateUser(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request, request AdminUserRequest) error {
+	if len(request.Password) == 0 {
+		return RErrMissing.Prepend("Password")
+	}
+
+	user := models.User{
+		Username: request.Username,
+		Password: request.Password,
+		RoleID:   request.RoleID,
+	}
+
+	err := user.Register(handlerData.Db, handlerData.Config)
+	switch err {
+	case nil:
+	case models.ErrorUserAlreadyExists:
+		return RErrAlreadyExists.Prepend("User")
+	case models.ErrorRoleNotFound:
+		return RErrNotFound.Prepend("Role")
+	default:
+		return err
+	}
+
+	handlerData.Log.WithField("admin", handlerData.User.Username).Infof("Created user '%s'", user.GetUsername())
+	if created, err := models.FindUser(handlerData.Db, user.Username); err == nil {
+		audit(handlerData, r, models.UserAuditEntry(models.AuditAdminUser.Sub("create"), created).WithChange(nil, created.Role.RoleName))
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", nil)
+	return nil
+}
+
+// Build the AdminUserItem for a user
+func adminUserItem(handlerData web.HandlerData, user *models.User) (*AdminUserItem, error) {
+	item := AdminUserItem{
+		ID:          user.ID,
+		Username:    user.Username,
+		RoleID:      user.RoleID,
+		Disabled:    user.Disabled,
+		Source:      user.AuthSource,
+		TOTPEnabled: user.HasTOTP(),
+		CreatedAt:   user.CreatedAt,
+	}
+
+	if user.Role != nil {
+		item.Role = user.Role.RoleName
+	}
+
+	var err error
+	if item.FileCount, err = user.GetFileCount(handlerData.Db); err != nil {
+		return nil, err
+	}
+	if item.TotalFileSize, err = user.GetTotalFilesize(handlerData.Db); err != nil {
+		return nil, err
+	}
+	if item.NamespaceCount, err = user.GetNamespaceCount(handlerData.Db); err != nil {
+		return nil, err
+	}
+
+	sessions, err := models.GetUserSessions(handlerData.Db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	item.SessionCount = len(sessions)
+
+	return &item, nil
+}
+
+// AdminLockoutListHandler lists all active lockouts
+func AdminLockoutListHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	failures, err := models.GetLockedSubjects(handlerData.Db)
+	if err != nil {
+		return err
+	}
+
+	response := LockoutListResponse{
+		Lockouts: make([]LockoutItem, len(failures)),
+	}
+
+	for i := range failures {
+		response.Lockouts[i] = LockoutItem{
+			Subject:     failures[i].Subject,
+			Failures:    failures[i].Failures,
+			LockedUntil: failures[i].LockedUntil,
+		}
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", response)
+	return nil
+}
+
+// AdminLockoutClearHandler clears the lockout of an IP and/or username
+func AdminLockoutClearHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request LockoutRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	var subjects []string
+	if len(request.IP) > 0 {
+		subjects = append(subjects, models.LockoutSubjectIP(request.IP))
+	}
+	if len(request.Username) > 0 {
+		subjects = append(subjects, models.LockoutSubjectUser(request.Username))
+	}
+
+	if len(subjects) == 0 {
+		return RErrMissing.Prepend("IP or username")
+	}
+
+	cleared, err := models.ResetLoginFailures(handlerData.Db, subjects...)
+	if err != nil {
+		return err
+	}
+
+	if cleared == 0 {
+		return RErrNotFound.Prepend("Lockout")
+	}
+
+	handlerData.Log.WithField("admin", handlerData.User.Username).Infof("Cleared lockout for %v", subjects)
+	audit(handlerData, r, models.AuditEntry{
+		Action:     models.AuditAdminLockout,
+		TargetType: models.AuditTargetLockout,
+	}.WithChange(subjects, nil))
+
+	sendResponse(w, libdm.ResponseSuccess, "", libdm.CountResponse{
+		Count: uint32(cleared),
+	})
+
+	return nil
+}
+
+// AdminRoleListHandler lists all roles
+func AdminRoleListHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	roles, err := models.GetAllRoles(handlerData.Db)
+	if err != nil {
+		return err
+	}
+
+	response := AdminRoleListResponse{
+		Roles: make([]AdminRoleItem, len(roles)),
+	}
+
+	for i := range roles {
+		item, err := adminRoleItem(handlerData, &roles[i])
+		if err != nil {
+			return err
+		}
+
+		response.Roles[i] = *item
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", response)
+	return nil
+}
+
+// AdminRoleHandler handler for role actions (create/update/delete)
+func AdminRoleHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	action := mux.Vars(r)["action"]
+	if !gaw.IsInStringArray(action, []string{"create", "update", "delete"}) {
+		return RErrBadRequest
+	}
+
+	var request AdminRoleRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	role := &models.Role{}
+	var before *models.Role
+	if action == "create" {
+		*role = models.NewRole("")
+	} else {
+		if request.ID == 0 {
+			return RErrMissing.Prepend("Role ID")
+		}
+
+		var err error
+		if role, err = models.FindRole(handlerData.Db, request.ID); err != nil {
+			if err == models.ErrorRoleNotFound {
+				return RErrNotFound.Prepend("Role")
+			}
+
+			return err
+		}
+	}
+
+	if action != "create" {
+		old := *role
+		before = &old
+	}
+
+	var err error
+	switch action {
+	case "create", "update":
+		request.apply(role)
+		if role.Validate(handlerData.Config) != nil {
+			return RErrInvalid.Prepend("Role")
+		}
+
+		if action == "create" {
+			err = role.Create(handlerData.Db)
+		} else {
+			err = role.Save(handlerData.Db)
+		}
+	case "delete":
+		err = role.Delete(handlerData.Db, handlerData.Config)
+	}
+
+	switch err {
+	case nil:
+	case models.ErrorRoleInUse, models.ErrorDefaultRole, models.ErrorLastAdmin:
+		return NewRequestError(err.Error(), http.StatusConflict)
+	default:
+		return err
+	}
+
+	handlerData.Log.WithField("admin", handlerData.User.Username).Infof("Applied '%s' to role '%s' (%d)", action, role.RoleName, role.ID)
+
+	entry := models.AuditEntry{
+		Action:     models.AuditAdminRole.Sub(action),
+		TargetType: models.AuditTargetRole,
+		TargetID:   role.ID,
+		Target:     role.RoleName,
+	}
+	if action == "delete" {
+		audit(handlerData, r, entry.WithChange(before, nil))
+	} else {
+		audit(handlerData, r, entry.WithChange(before, role))
+	}
+
+	item, err := adminRoleItem(handlerData, role)
+	if err != nil {
+		return err
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", item)
+	return nil
+}
+
+// Apply all set values of the request to role
+func (request AdminRoleRequest) apply(role *models.Role) {
+	if request.Name != nil {
+		role.RoleName = *request.Name
+	}
+	if request.Permissions != nil {
+		role.Permissions = *request.Permissions
+	}
+	if request.MaxURLContentSize != nil {
+		role.MaxURLcontentSize = *request.MaxURLContentSize
+	}
+	if request.MaxUploadFileSize != nil {
+		role.MaxUploadFileSize = *request.MaxUploadFileSize
+	}
+	if request.Require2FA != nil {
+		role.Require2FA = *request.Require2FA
+	}
+}
+
+// Build the AdminRoleItem for a role
+func adminRoleItem(handlerData web.HandlerData, role *models.Role) (*AdminRoleItem, error) {
+	users, err := role.GetUserCount(handlerData.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AdminRoleItem{
+		ID:                role.ID,
+		Name:              role.RoleName,
+		Permissions:       role.Permissions,
+		MaxURLContentSize: role.MaxURLcontentSize,
+		MaxUploadFileSize: role.MaxUploadFileSize,
+		Require2FA:        role.Require2FA,
+		Default:           role.ID == handlerData.Config.Server.Roles.DefaultRole,
+		Users:             users,
+	}, nil
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	libdm "github.com/DataManager-Go/libdatamanager"
+	"gorm.io/gorm"
+)
+
+// Limits for audit queries
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditRequest filters for querying the audit log
+type AuditRequest struct {
+	Action    string    `json:"action,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	Namespace string    `json:"ns,omitempty"`
+	FileID    uint      `json:"fid,omitempty"`
+	Since     time.Time `json:"since,omitempty"`
+	Until     time.Time `json:"until,omitempty"`
+	BeforeID  uint      `json:"before,omitempty"`
+	Limit     int       `json:"limit,omitempty"`
+}
+
+// AuditItem an entry of the audit log
+type AuditItem struct {
+	ID         uint               `json:"id"`
+	Time       time.Time          `json:"time"`
+	ActorID    uint               `json:"actorID,omitempty"`
+	Actor      string             `json:"actor,omitempty"`
+	IP         string             `json:"ip,omitempty"`
+	Action     models.AuditAction `json:"action"`
+	Namespace  string             `json:"ns,omitempty"`
+	TargetType string             `json:"targetType"`
+	TargetID   uint               `json:"targetID,omitempty"`
+	Target     string             `json:"target,omitempty"`
+	Before     json.RawMessage    `json:"before,omitempty"`
+	After      json.RawMessage    `json:"after,omitempty"`
+}
+
+// AuditListResponse response containing audit entries, newest first
+type AuditListResponse struct {
+	Entries []AuditItem `json:"entries"`
+}
+
+// Record an action of the requesting user in the audit log.
+// Errors are only logged to not fail the audited action
+func audit(handlerData web.HandlerData, r *http.Request, entry models.AuditEntry) {
+	auditAs(handlerData, r, handlerData.User, entry)
+}
+
+// Record an action of actor in the audit log
+func auditAs(handlerData web.HandlerData, r *http.Request, actor *models.User, entry models.AuditEntry) {
+	if actor != nil {
+		entry.ActorID = actor.ID
+		entry.Actor = actor.Username
+	}
+
+	entry.IP = GetClientIP(handlerData.Config, r)
+	handlerData.LogError(entry.Create(handlerData.Db))
+}
+
+// Returns an entry for an action on a tag or group
+func attributeAuditEntry(action models.AuditAction, targetType string, id uint, name string, namespace *models.Namespace) models.AuditEntry {
+	return models.AuditEntry{
+		Action:      action,
+		NamespaceID: namespace.ID,
+		TargetType:  targetType,
+		TargetID:    id,
+		Target:      name,
+	}
+}
+
+// Returns an entry for an action on namespace
+func namespaceAuditEntry(action models.AuditAction, namespace *models.Namespace) models.AuditEntry {
+	return models.AuditEntry{
+		Action:      action,
+		NamespaceID: namespace.ID,
+		TargetType:  models.AuditTargetNamespace,
+		TargetID:    namespace.ID,
+		Target:      namespace.Name,
+	}
+}
+
+// AuditHandler lists audit entries of the users
+// namespaces and actions targeting the user
+func AuditHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request AuditRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	namespaces, err := models.FindUserNamespaces(handlerData.Db, handlerData.User)
+	if err != nil {
+		return err
+	}
+
+	filter := models.AuditFilter{
+		NamespaceIDs: make([]uint, len(namespaces)),
+		UserID:       handlerData.User.ID,
+	}
+	for i := range namespaces {
+		filter.NamespaceIDs[i] = namespaces[i].ID
+	}
+
+	if len(request.Namespace) > 0 {
+		namespace := models.FindNamespace(handlerData.Db, request.Namespace, handlerData.User)
+		if !namespace.IsValid() {
+			return RErrNotFound.Prepend("Namespace")
+		}
+
+		filter.NamespaceID = namespace.ID
+	}
+
+	return sendAuditEntries(handlerData, w, request, filter)
+}
+
+// AdminAuditHandler lists all audit entries
+func AdminAuditHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request AuditRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	var filter models.AuditFilter
+	if len(request.Namespace) > 0 {
+		namespace, err := models.FindNamespaceByName(handlerData.Db, request.Namespace)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return RErrNotFound.Prepend("Namespace")
+			}
+
+			return err
+		}
+
+		filter.NamespaceID = namespace.ID
+	}
+
+	return sendAuditEntries(handlerData, w, request, filter)
+}
+
+// Apply the remaining filters of request and send the matching entries
+func sendAuditEntries(handlerData web.HandlerData, w http.ResponseWriter, request AuditRequest, filter models.AuditFilter) error {
+	if len(request.Actor) > 0 {
+		actor, err := models.FindUser(handlerData.Db, request.Actor)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return RErrNotFound.Prepend("User")
+			}
+
+			return err
+		}
+
+		filter.ActorID = actor.ID
+	}
+
+	if request.FileID > 0 {
+		filter.TargetType = models.AuditTargetFile
+		filter.TargetID = request.FileID
+	}
+
+	filter.Action = models.AuditAction(request.Action)
+	filter.Since = request.Since
+	filter.Until = request.Until
+	filter.BeforeID = request.BeforeID
+
+	filter.Limit = request.Limit
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	} else if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+
+	entries, err := models.GetAuditEntries(handlerData.Db, filter)
+	if err != nil {
+		return err
+	}
+
+	// Resolve namespace names
+	var namespaceIDs []uint
+	for i := range entries {
+		if entries[i].NamespaceID > 0 {
+			namespaceIDs = append(namespaceIDs, entries[i].NamespaceID)
+		}
+	}
+
+	namespaces, err := models.GetNamespaceNames(handlerData.Db, namespaceIDs)
+	if err != nil {
+		return err
+	}
+
+	response := AuditListResponse{
+		Entries: make([]AuditItem, len(entries)),
+	}
+
+	for i, entry := range entries {
+		response.Entries[i] = AuditItem{
+			ID:         entry.ID,
+			Time:       entry.CreatedAt,
+			ActorID:    entry.ActorID,
+			Actor:      entry.Actor,
+			IP:         entry.IP,
+			Action:     entry.Action,
+			Namespace:  namespaces[entry.NamespaceID],
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			Target:     entry.Target,
+		}
+
+		if len(entry.Before) > 0 {
+			response.Entries[i].Before = json.RawMessage(entry.Before)
+		}
+		if len(entry.After) > 0 {
+			response.Entries[i].After = json.RawMessage(entry.After)
+		}
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", response)
+	return nil
+}
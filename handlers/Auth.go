@@ -7,8 +7,9 @@ import (
 )
 
 /*
-	A wrapper for supported Authorization mechanisms. Currently Only Bearer token
-	are supported which are provided by an "Authorization" header inside the request
+	A wrapper for supported Authorization mechanisms. Bearer token are provided
+	by an "Authorization" header inside the request. Client certificates are
+	verified by the TLS server
 */
 
 // ErrorTokenInvalid error if token is invalid
@@ -36,6 +37,35 @@ func (authHandler AuthHandler) GetBearer() string {
 	return tokenFromBearerHeader(authHeader[0])
 }
 
+// GetCertificateUsername returns the username of a verified client
+// certificate. field is one of models.ClientCertUsernameFields
+func (authHandler AuthHandler) GetCertificateUsername(field string) string {
+	tlsState := authHandler.Request.TLS
+	if tlsState == nil || len(tlsState.VerifiedChains) == 0 || len(tlsState.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	cert := tlsState.VerifiedChains[0][0]
+	switch field {
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case "uri":
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+
+	return ""
+}
+
 // Parse the Authorization header and return its real value (the token)
 func tokenFromBearerHeader(header string) string {
 	return strings.TrimSpace(strings.ReplaceAll(header, "Bearer", ""))
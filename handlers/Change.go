@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	libdm "github.com/DataManager-Go/libdatamanager"
+)
+
+const (
+	// Limits for change queries
+	defaultChangeLimit = 500
+	maxChangeLimit     = 1000
+
+	// Max time to wait for changes in long-poll mode
+	maxChangeWait = 60 * time.Second
+
+	// Interval for keep-alive comments on change streams
+	changeKeepAlive = 30 * time.Second
+)
+
+// ChangesRequest request for changes after a cursor
+type ChangesRequest struct {
+	Cursor uint `json:"cursor"`
+	Limit  int  `json:"limit,omitempty"`
+	// Seconds to wait for changes if there are none
+	Wait int `json:"wait,omitempty"`
+	// Only return the current cursor
+	Latest bool `json:"latest,omitempty"`
+}
+
+// ChangeItem a change of a file, attribute or namespace
+type ChangeItem struct {
+	ID        uint              `json:"id"`
+	Time      time.Time         `json:"time"`
+	Kind      models.ChangeKind `json:"kind"`
+	Op        models.ChangeOp   `json:"op"`
+	TargetID  uint              `json:"targetID"`
+	Name      string            `json:"name,omitempty"`
+	Namespace string            `json:"ns,omitempty"`
+}
+
+// ChangesResponse response containing changes, oldest first. Cursor
+// is passed to get the next changes. Resync is set if the changes
+// after the requested cursor were deleted already, clients have to
+// list everything and continue with the returned cursor
+type ChangesResponse struct {
+	Changes []ChangeItem `json:"changes"`
+	Cursor  uint         `json:"cursor"`
+	More    bool         `json:"more,omitempty"`
+	Resync  bool         `json:"resync,omitempty"`
+}
+
+// ChangesHandler returns the changes of the user after a cursor
+// and optionally waits for changes if there are none
+func ChangesHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request ChangesRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	if request.Limit <= 0 {
+		request.Limit = defaultChangeLimit
+	} else if request.Limit > maxChangeLimit {
+		request.Limit = maxChangeLimit
+	}
+
+	expired, err := models.IsChangeCursorExpired(handlerData.Db, request.Cursor)
+	if err != nil {
+		return err
+	}
+
+	if request.Latest || expired {
+		cursor, err := models.GetChangeCursor(handlerData.Db)
+		if err != nil {
+			return err
+		}
+
+		sendResponse(w, libdm.ResponseSuccess, "", ChangesResponse{
+			Changes: []ChangeItem{},
+			Cursor:  cursor,
+			Resync:  expired,
+		})
+
+		return nil
+	}
+
+	// Get the notification before querying to not miss changes
+	notification := models.ChangeNotification(handlerData.User.ID)
+
+	// Get one more change to know if there are more
+	changes, err := models.GetChanges(handlerData.Db, handlerData.User.ID, request.Cursor, request.Limit+1)
+	if err != nil {
+		return err
+	}
+
+	// Wait for changes
+	if len(changes) == 0 && request.Wait > 0 {
+		wait := time.Duration(request.Wait) * time.Second
+		if wait > maxChangeWait {
+			wait = maxChangeWait
+		}
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-notification:
+			changes, err = models.GetChanges(handlerData.Db, handlerData.User.ID, request.Cursor, request.Limit+1)
+			if err != nil {
+				return err
+			}
+		case <-timer.C:
+		case <-shutdown:
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+
+	response := ChangesResponse{
+		Cursor: request.Cursor,
+	}
+
+	if len(changes) > request.Limit {
+		changes = changes[:request.Limit]
+		response.More = true
+	}
+
+	response.Changes, err = changeItems(handlerData, changes)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) > 0 {
+		response.Cursor = changes[len(changes)-1].ID
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", response)
+	return nil
+}
+
+// ChangeStreamHandler streams the changes of the user after the cursor
+// as Server-Sent Events. The cursor is taken from the 'cursor' parameter
+// or the Last-Event-ID header of reconnecting clients
+func ChangeStreamHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return RErrNotSupported.Prepend("Streaming is")
+	}
+
+	cursorString := r.Header.Get("Last-Event-ID")
+	if len(cursorString) == 0 {
+		cursorString = r.URL.Query().Get("cursor")
+	}
+
+	var cursor uint
+	if len(cursorString) > 0 {
+		c, err := strconv.ParseUint(cursorString, 10, 32)
+		if err != nil {
+			return RErrInvalid.Prepend("Cursor").WithCode(http.StatusBadRequest)
+		}
+
+		cursor = uint(c)
+	}
+
+	expired, err := models.IsChangeCursorExpired(handlerData.Db, cursor)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Let the client resync and continue with the latest cursor
+	if expired {
+		if cursor, err = models.GetChangeCursor(handlerData.Db); err != nil {
+			handlerData.LogError(err)
+			return nil
+		}
+
+		fmt.Fprintf(w, "id: %d\nevent: resync\ndata: {\"cursor\":%d}\n\n", cursor, cursor)
+	}
+
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(changeKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		notification := models.ChangeNotification(handlerData.User.ID)
+
+		changes, err := models.GetChanges(handlerData.Db, handlerData.User.ID, cursor, maxChangeLimit)
+		if err != nil {
+			handlerData.LogError(err)
+			return nil
+		}
+
+		items, err := changeItems(handlerData, changes)
+		if err != nil {
+			handlerData.LogError(err)
+			return nil
+		}
+
+		for i := range items {
+			data, err := json.Marshal(items[i])
+			if err != nil {
+				handlerData.LogError(err)
+				return nil
+			}
+
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: change\ndata: %s\n\n", items[i].ID, data); err != nil {
+				return nil
+			}
+
+			cursor = items[i].ID
+		}
+
+		flusher.Flush()
+
+		// Send remaining changes first
+		if len(changes) == maxChangeLimit {
+			continue
+		}
+
+		select {
+		case <-notification:
+		case <-keepAlive.C:
+			if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+
+			flusher.Flush()
+		case <-shutdown:
+			return nil
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Build the ChangeItems of changes
+func changeItems(handlerData web.HandlerData, changes []models.Change) ([]ChangeItem, error) {
+	namespaceIDs := make([]uint, len(changes))
+	for i := range changes {
+		namespaceIDs[i] = changes[i].NamespaceID
+	}
+
+	namespaces, err := models.GetNamespaceNames(handlerData.Db, namespaceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ChangeItem, len(changes))
+	for i, change := range changes {
+		items[i] = ChangeItem{
+			ID:        change.ID,
+			Time:      change.CreatedAt,
+			Kind:      change.Kind,
+			Op:        change.Op,
+			TargetID:  change.TargetID,
+			Name:      change.Name,
+			Namespace: namespaces[change.NamespaceID],
+		}
+	}
+
+	return items, nil
+}
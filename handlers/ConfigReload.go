@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	libdm "github.com/DataManager-Go/libdatamanager"
+)
+
+// ConfigReloadHandler reloads the config and returns the changed settings
+func ConfigReloadHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	changes, err := models.ReloadConfig()
+	if err != nil {
+		if errors.Is(err, models.ErrorInvalidConfig) {
+			handlerData.Log.Warnf("Can't reload config: %s", err)
+			return RErrInvalid.Prepend("Config")
+		}
+
+		return err
+	}
+
+	audit(handlerData, r, models.AuditEntry{
+		Action:     models.AuditAdminConfig,
+		TargetType: models.AuditTargetConfig,
+	}.WithChange(nil, changes))
+
+	sendResponse(w, libdm.ResponseSuccess, "", changes)
+	return nil
+}
@@ -41,6 +41,24 @@ var (
 	// RErrPermissionDenied if a user has no permission to run a certain command
 	RErrPermissionDenied = NewRequestError("permission denied", http.StatusForbidden)
 
+	// RErrTooManyAttempts if a client is locked out after too many failed attempts
+	RErrTooManyAttempts = NewRequestError("Too many failed attempts. Try again later", http.StatusTooManyRequests)
+
+	// RErrSecondFactorRequired if a login requires a TOTP or recovery code
+	RErrSecondFactorRequired = NewRequestError("Second factor required", http.StatusUnauthorized)
+
+	// RErrSecondFactorEnrollment if a users role requires 2FA which isn't enrolled yet
+	RErrSecondFactorEnrollment = NewRequestError("Two-factor authentication is required for your role. Enroll first", http.StatusForbidden)
+
+	// RErrExternalSecondFactor if a users role requires 2FA which an external login can't provide
+	RErrExternalSecondFactor = NewRequestError("Two-factor authentication is required for your role. Login with your password", http.StatusUnauthorized)
+
+	// RErrUserDisabled if a disabled user tries to login
+	RErrUserDisabled = NewRequestError("Account disabled", http.StatusForbidden)
+
+	// RErrExternalUser if an account managed by an external directory should be changed
+	RErrExternalUser = NewRequestError("Account is managed by an external directory", http.StatusConflict)
+
 	// RErrMissing if registration is not accepted
 	RErrRegistrationNotAccepted = NewRequestError("Registration not accepted", http.StatusForbidden)
 )
@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/metrics"
 	"github.com/DataManager-Go/DataManagerServer/models"
 	libdm "github.com/DataManager-Go/libdatamanager"
 	"github.com/JojiiOfficial/gaw"
@@ -73,10 +74,13 @@ func FileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Req
 		return NewRequestError("found multiple files with same name", http.StatusConflict)
 	}
 
-	// If namespace was not set, use the namespace of the returned file
+	// If namespace was not set, use the namespace of the returned file.
+	// Downloading only requires read access
 	if namespace == nil {
 		namespace = files[0].Namespace
-		if !handlerData.User.HasAccess(namespace) {
+
+		if action == "get" && !handlerData.User.HasReadAccess(namespace) ||
+			action != "get" && !handlerData.User.HasAccess(namespace) {
 			return RErrPermissionDenied.Append("for this namespace")
 		}
 	}
@@ -94,6 +98,9 @@ func FileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Req
 					return err
 				}
 
+				audit(handlerData, r, models.FileAuditEntry(models.AuditFileDelete, &file))
+				triggerWebhooks(handlerData, models.WebhookDeleted, &file)
+
 				ids[i] = file.ID
 			}
 
@@ -108,7 +115,7 @@ func FileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Req
 			var didUpdate bool
 
 			for _, file := range files {
-				didUpdate, err = updateFile(&file, handlerData, request.Updates)
+				didUpdate, err = updateFile(&file, handlerData, r, request.Updates)
 				if err != nil {
 					return err
 				}
@@ -133,10 +140,12 @@ func FileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Req
 			if err != nil {
 				return err
 			}
+
+			audit(handlerData, r, models.FileAuditEntry(models.AuditFileDownload, &files[0]))
 		}
 	case "publish":
 		{
-			resp, err := publishFiles(files, request.PublicName, request.All, handlerData.Db)
+			resp, err := publishFiles(handlerData, r, files, request.PublicName, request.All)
 			if err != nil {
 				return err
 			}
@@ -175,7 +184,7 @@ func validateFileActionRequest(r *http.Request, w http.ResponseWriter, handlerDa
 		namespace = models.FindNamespace(handlerData.Db, request.Attributes.Namespace, handlerData.User)
 
 		// Handle namespace errors (not found || no access)
-		if !handleNamespaceErorrs(namespace, handlerData.User, w) {
+		if !handleNamespaceErorrs(namespace, handlerData.User, action != "get", w) {
 			return nil, "", nil
 		}
 	}
@@ -185,6 +194,16 @@ func validateFileActionRequest(r *http.Request, w http.ResponseWriter, handlerDa
 		return nil, "", RErrInvalid.Append("action")
 	}
 
+	// Check if the users role allows the action
+	switch action {
+	case "delete":
+		return namespace, action, checkPermission(handlerData.User, models.PermissionDeleteFiles, "delete files")
+	case "publish":
+		return namespace, action, checkPermission(handlerData.User, models.PermissionPublish, "publish files")
+	case "update":
+		return namespace, action, checkUpdatePermissions(handlerData.User, request.Updates)
+	}
+
 	return namespace, action, nil
 }
 
@@ -192,7 +211,7 @@ func validateFileActionRequest(r *http.Request, w http.ResponseWriter, handlerDa
 func serveFile(file models.File, w http.ResponseWriter, handlerData web.HandlerData) error {
 	// Open local file
 	f, err := os.Open(handlerData.Config.GetStorageFile(file.LocalName))
-	if LogError(err) {
+	if handlerData.LogError(err) {
 		if os.IsNotExist(err) {
 			return RErrNotFound.Prepend("File").Append("on server")
 		}
@@ -216,7 +235,8 @@ func serveFile(file models.File, w http.ResponseWriter, handlerData web.HandlerD
 
 	// Write contents to responsewriter
 	buff := make([]byte, 1024*1024)
-	_, err = io.CopyBuffer(w, f, buff)
+	n, err := io.CopyBuffer(w, f, buff)
+	metrics.DownloadedBytes.Add(float64(n))
 	if err != nil {
 		switch err {
 		case io.EOF, io.ErrUnexpectedEOF:
@@ -227,12 +247,12 @@ func serveFile(file models.File, w http.ResponseWriter, handlerData web.HandlerD
 	}
 
 	// Close file
-	LogError(f.Close())
+	handlerData.LogError(f.Close())
 	return nil
 }
 
 // Publish multiple files
-func publishFiles(files []models.File, publicName string, all bool, db *gorm.DB) (interface{}, error) {
+func publishFiles(handlerData web.HandlerData, r *http.Request, files []models.File, publicName string, all bool) (interface{}, error) {
 	bulkPublishResponse := libdm.BulkPublishResponse{}
 
 	for _, file := range files {
@@ -246,7 +266,15 @@ func publishFiles(files []models.File, publicName string, all bool, db *gorm.DB)
 			continue
 		}
 
-		nameTaken, err := file.Publish(db, publicName)
+		var nameTaken bool
+		err := models.WithChanges(handlerData.Db, func(tx *gorm.DB, changes *models.ChangeLog) error {
+			var err error
+			if nameTaken, err = file.Publish(tx, publicName); err != nil || nameTaken {
+				return err
+			}
+
+			return changes.Record(file.NamespaceID, models.ChangeFile, models.ChangeUpdated, file.ID, file.Name)
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -255,6 +283,9 @@ func publishFiles(files []models.File, publicName string, all bool, db *gorm.DB)
 			return nil, RErrAlreadyExists.Prepend("Public name")
 		}
 
+		audit(handlerData, r, models.FileAuditEntry(models.AuditFilePublish, &file).WithChange(nil, file.PublicFilename.String))
+		triggerWebhooks(handlerData, models.WebhookPublished, &file)
+
 		if all && len(files) > 1 {
 			bulkPublishResponse.Files = append(bulkPublishResponse.Files, libdm.UploadResponse{
 				FileID:         file.ID,
@@ -271,101 +302,212 @@ func publishFiles(files []models.File, publicName string, all bool, db *gorm.DB)
 	return bulkPublishResponse, nil
 }
 
-// Apply all given updates to a file
-func updateFile(file *models.File, handlerData web.HandlerData, update libdm.FileUpdateItem) (didUpdate bool, err error) {
-	// Update namespace
-	if len(update.NewNamespace) > 0 {
-		// Get new namespace
-		newNamespace := models.FindNamespace(handlerData.Db, update.NewNamespace, handlerData.User)
-		if newNamespace == nil || file.Namespace.ID == 0 {
-			err = RErrNotFound.Prepend("New namespace")
-			return
+// Check if user is allowed to apply all given updates
+func checkUpdatePermissions(user *models.User, update libdm.FileUpdateItem) error {
+	if len(update.NewNamespace) > 0 || len(update.NewName) > 0 {
+		if err := checkPermission(user, models.PermissionEditFiles, "edit files"); err != nil {
+			return err
 		}
+	}
 
-		// Check if user can access this new namespace
-		if !newNamespace.IsOwnedBy(handlerData.User) && !handlerData.User.CanWriteForeignNamespace() {
-			err = RErrPermissionDenied.Append("for this namespace")
-			return
+	if len(update.IsPublic) > 0 {
+		if err := checkPermission(user, models.PermissionPublish, "publish files"); err != nil {
+			return err
 		}
+	}
 
-		// Update files namespace
-		err = file.UpdateNamespace(handlerData.Db, newNamespace, handlerData.User)
-		if err != nil {
-			return
+	if len(update.AddTags) > 0 || len(update.RemoveTags) > 0 || len(update.AddGroups) > 0 || len(update.RemoveGroups) > 0 {
+		return checkPermission(user, models.PermissionManageAttributes, "manage tags and groups")
+	}
+
+	return nil
+}
+
+// Apply all given updates to a file. Either all or none
+// of them are applied
+func updateFile(file *models.File, handlerData web.HandlerData, r *http.Request, update libdm.FileUpdateItem) (didUpdate bool, err error) {
+	// Attributes before the update
+	tags := models.TagArrToStringArr(file.Tags)
+	groups := models.GroupArrToStringArr(file.Groups)
+
+	// Audit entries and webhooks of the applied
+	// updates are created after committing them
+	var events []func()
+
+	err = models.WithChanges(handlerData.Db, func(tx *gorm.DB, changes *models.ChangeLog) error {
+		var changed bool
+
+		// Update namespace
+		if len(update.NewNamespace) > 0 {
+			// Get new namespace
+			newNamespace := models.FindNamespace(tx, update.NewNamespace, handlerData.User)
+			if !newNamespace.IsValid() {
+				return RErrNotFound.Prepend("New namespace")
+			}
+
+			// Check if user can access this new namespace
+			if !newNamespace.IsOwnedBy(handlerData.User) && !handlerData.User.CanWriteForeignNamespace() {
+				return RErrPermissionDenied.Append("for this namespace")
+			}
+
+			// Update files namespace
+			oldNamespace := file.Namespace
+			if err := file.UpdateNamespace(tx, newNamespace, handlerData.User); err != nil {
+				return err
+			}
+
+			if err := changes.Record(oldNamespace.ID, models.ChangeFile, models.ChangeDeleted, file.ID, file.Name); err != nil {
+				return err
+			}
+
+			if err := changes.Record(newNamespace.ID, models.ChangeFile, models.ChangeCreated, file.ID, file.Name); err != nil {
+				return err
+			}
+
+			events = append(events, func() {
+				audit(handlerData, r, models.FileAuditEntry(models.AuditFileMove, file).WithChange(oldNamespace.Name, newNamespace.Name))
+			})
+
+			didUpdate = true
 		}
 
-		didUpdate = true
-	}
+		// Rename file
+		if len(update.NewName) > 0 {
+			oldName := file.Name
+			if err := file.Rename(tx, update.NewName); err != nil {
+				return err
+			}
+
+			newName := file.Name
+			events = append(events, func() {
+				audit(handlerData, r, models.FileAuditEntry(models.AuditFileRename, file).WithChange(oldName, newName))
+			})
 
-	// Rename file
-	if len(update.NewName) > 0 {
-		if err = file.Rename(handlerData.Db, update.NewName); err != nil {
-			return
+			changed = true
+			didUpdate = true
 		}
 
-		didUpdate = true
-	}
+		// Set public/private
+		if len(update.IsPublic) > 0 {
+			if !file.PublicFilename.Valid {
+				return NewRequestError("You need to share this file first", http.StatusBadRequest)
+			}
 
-	// Set public/private
-	if len(update.IsPublic) > 0 {
-		if !file.PublicFilename.Valid {
-			err = NewRequestError("You need to share this file first", http.StatusBadRequest)
-			return
+			newVisibility, err := strconv.ParseBool(update.IsPublic)
+			if err != nil {
+				return NewRequestError("isPublic must be a bool", http.StatusUnprocessableEntity)
+			}
+
+			wasPublic := file.IsPublic
+			if err = file.SetVilibility(tx, newVisibility); err != nil {
+				return err
+			}
+
+			if wasPublic != newVisibility {
+				action := models.AuditFilePrivate
+				if newVisibility {
+					action = models.AuditFilePublish
+				}
+
+				events = append(events, func() {
+					audit(handlerData, r, models.FileAuditEntry(action, file).WithChange(nil, file.PublicFilename.String))
+					if newVisibility {
+						triggerWebhooks(handlerData, models.WebhookPublished, file)
+					}
+				})
+
+				changed = true
+			}
+
+			didUpdate = true
 		}
 
-		var newVisibility bool
-		newVisibility, err = strconv.ParseBool(update.IsPublic)
-		if err != nil {
-			err = NewRequestError("isPublic must be a bool", http.StatusUnprocessableEntity)
-			return
+		// Add tags
+		if len(update.AddTags) > 0 {
+			currLenTags := len(file.Tags)
+			if err := file.AddTags(tx, update.AddTags, handlerData.User); err != nil {
+				return err
+			}
+
+			didUpdate = len(file.Tags) > currLenTags
 		}
 
-		if err = file.SetVilibility(handlerData.Db, newVisibility); err != nil {
-			return
+		// Remove tags
+		if len(update.RemoveTags) > 0 {
+			currLenTags := len(file.Tags)
+			if err := file.RemoveTags(tx, update.RemoveTags); err != nil {
+				return err
+			}
+
+			didUpdate = len(file.Tags) < currLenTags
 		}
 
-		didUpdate = true
-	}
+		// Add Groups
+		if len(update.AddGroups) > 0 {
+			currLenGroups := len(file.Groups)
+			if err := file.AddGroups(tx, update.AddGroups, handlerData.User); err != nil {
+				return err
+			}
 
-	// Add tags
-	if len(update.AddTags) > 0 {
-		currLenTags := len(file.Tags)
-		if err = file.AddTags(handlerData.Db, update.AddTags, handlerData.User); err != nil {
-			return
+			didUpdate = len(file.Groups) > currLenGroups
 		}
 
-		didUpdate = len(file.Tags) > currLenTags
-	}
+		// Remove Groups
+		if len(update.RemoveGroups) > 0 {
+			currLenGroups := len(file.Groups)
+			if err := file.RemoveGroups(tx, update.RemoveGroups); err != nil {
+				return err
+			}
 
-	// Remove tags
-	if len(update.RemoveTags) > 0 {
-		currLenTags := len(file.Tags)
-		if err = file.RemoveTags(handlerData.Db, update.RemoveTags); err != nil {
-			return
+			didUpdate = len(file.Groups) < currLenGroups
 		}
 
-		didUpdate = len(file.Tags) < currLenTags
-	}
+		// Record changed attributes
+		if newTags := models.TagArrToStringArr(file.Tags); !equalStrings(tags, newTags) {
+			events = append(events, func() {
+				audit(handlerData, r, models.FileAuditEntry(models.AuditFileTags, file).WithChange(tags, newTags))
+				triggerWebhooks(handlerData, models.WebhookTagged, file)
+			})
 
-	// Add Groups
-	if len(update.AddGroups) > 0 {
-		currLenGroups := len(file.Groups)
-		if err = file.AddGroups(handlerData.Db, update.AddGroups, handlerData.User); err != nil {
-			return
+			changed = true
 		}
+		if newGroups := models.GroupArrToStringArr(file.Groups); !equalStrings(groups, newGroups) {
+			events = append(events, func() {
+				audit(handlerData, r, models.FileAuditEntry(models.AuditFileGroups, file).WithChange(groups, newGroups))
+			})
 
-		didUpdate = len(file.Groups) > currLenGroups
-	}
+			changed = true
+		}
 
-	// Remove Groups
-	if len(update.RemoveGroups) > 0 {
-		currLenGroups := len(file.Groups)
-		if err = file.RemoveGroups(handlerData.Db, update.RemoveGroups); err != nil {
-			return
+		if !changed {
+			return nil
 		}
 
-		didUpdate = len(file.Groups) < currLenGroups
+		return changes.Record(file.NamespaceID, models.ChangeFile, models.ChangeUpdated, file.ID, file.Name)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, event := range events {
+		event()
 	}
 
 	return
 }
+
+// Returns true if a and b contain the same strings in the same order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -42,10 +42,17 @@ func AttributeHandler(handlerData web.HandlerData, w http.ResponseWriter, r *htt
 
 	// Find namespace and handle namespace errors (not found || no access)
 	namespace := models.FindNamespace(handlerData.Db, request.Namespace, handlerData.User)
-	if !handleNamespaceErorrs(namespace, handlerData.User, w) {
+	if !handleNamespaceErorrs(namespace, handlerData.User, action != "get", w) {
 		return nil
 	}
 
+	// Changing attributes requires permission
+	if action != "get" {
+		if err := checkPermission(handlerData.User, models.PermissionManageAttributes, "manage tags and groups"); err != nil {
+			return err
+		}
+	}
+
 	// check newName availability
 	if action == "update" && len(request.NewName) == 0 {
 		return RErrBadRequest
@@ -72,25 +79,42 @@ func AttributeHandler(handlerData web.HandlerData, w http.ResponseWriter, r *htt
 					{
 						// Update tags name
 						tag.Name = request.NewName
-						err := handlerData.Db.Save(tag).Error
+						err := models.WithChanges(handlerData.Db, func(tx *gorm.DB, changes *models.ChangeLog) error {
+							if err := tx.Save(tag).Error; err != nil {
+								return err
+							}
+
+							return changes.Record(namespace.ID, models.ChangeTag, models.ChangeUpdated, tag.ID, tag.Name)
+						})
 
 						if err != nil {
 							return err
 						}
+
+						audit(handlerData, r, attributeAuditEntry(models.AuditAttrRename, models.AuditTargetTag, tag.ID, tag.Name, namespace).WithChange(request.Name, tag.Name))
 					}
 				case "delete":
 					{
-						// Delete relations
-						err = handlerData.Db.Unscoped().Table("files_tags").Where("tag_id=?", tag.ID).Delete(models.Tag{}).Error
-						if err != nil {
-							return err
-						}
+						err = models.WithChanges(handlerData.Db, func(tx *gorm.DB, changes *models.ChangeLog) error {
+							// Delete relations
+							err := tx.Unscoped().Table("files_tags").Where("tag_id=?", tag.ID).Delete(models.Tag{}).Error
+							if err != nil {
+								return err
+							}
+
+							// Delete tags
+							if err = tx.Delete(tag).Error; err != nil {
+								return err
+							}
+
+							return changes.Record(namespace.ID, models.ChangeTag, models.ChangeDeleted, tag.ID, tag.Name)
+						})
 
-						// Delete tags
-						err = handlerData.Db.Delete(tag).Error
 						if err != nil {
 							return err
 						}
+
+						audit(handlerData, r, attributeAuditEntry(models.AuditAttrDelete, models.AuditTargetTag, tag.ID, tag.Name, namespace))
 					}
 				}
 			}
@@ -120,11 +144,20 @@ func AttributeHandler(handlerData web.HandlerData, w http.ResponseWriter, r *htt
 				}
 
 				// Save tag
-				err = tag.Insert(handlerData.Db, handlerData.User)
+				err = models.WithChanges(handlerData.Db, func(tx *gorm.DB, changes *models.ChangeLog) error {
+					if err := tag.Insert(tx, handlerData.User); err != nil {
+						return err
+					}
+
+					return changes.Record(namespace.ID, models.ChangeTag, models.ChangeCreated, tag.ID, tag.Name)
+				})
+
 				if err != nil {
 					return err
 				}
 
+				audit(handlerData, r, attributeAuditEntry(models.AuditAttrCreate, models.AuditTargetTag, tag.ID, tag.Name, namespace))
+
 				sendResponse(w, libdm.ResponseSuccess, "", nil)
 				return nil
 			}
@@ -149,26 +182,44 @@ func AttributeHandler(handlerData web.HandlerData, w http.ResponseWriter, r *htt
 				case "delete":
 					{
 
-						// Delete relations
-						err = handlerData.Db.Unscoped().Table("files_groups").Where("group_id=?", group.ID).Delete(models.Group{}).Error
-						if err != nil {
-							return err
-						}
+						err = models.WithChanges(handlerData.Db, func(tx *gorm.DB, changes *models.ChangeLog) error {
+							// Delete relations
+							err := tx.Unscoped().Table("files_groups").Where("group_id=?", group.ID).Delete(models.Group{}).Error
+							if err != nil {
+								return err
+							}
+
+							// Delete tags
+							if err = tx.Delete(group).Error; err != nil {
+								return err
+							}
+
+							return changes.Record(namespace.ID, models.ChangeGroup, models.ChangeDeleted, group.ID, group.Name)
+						})
 
-						// Delete tags
-						err = handlerData.Db.Delete(group).Error
 						if err != nil {
 							return err
 						}
+
+						audit(handlerData, r, attributeAuditEntry(models.AuditAttrDelete, models.AuditTargetGroup, group.ID, group.Name, namespace))
 					}
 				case "update":
 					{
 						// Update groups name
 						group.Name = request.NewName
-						err := handlerData.Db.Save(group).Error
+						err := models.WithChanges(handlerData.Db, func(tx *gorm.DB, changes *models.ChangeLog) error {
+							if err := tx.Save(group).Error; err != nil {
+								return err
+							}
+
+							return changes.Record(namespace.ID, models.ChangeGroup, models.ChangeUpdated, group.ID, group.Name)
+						})
+
 						if err != nil {
 							return err
 						}
+
+						audit(handlerData, r, attributeAuditEntry(models.AuditAttrRename, models.AuditTargetGroup, group.ID, group.Name, namespace).WithChange(request.Name, group.Name))
 					}
 				}
 			}
@@ -198,10 +249,19 @@ func AttributeHandler(handlerData web.HandlerData, w http.ResponseWriter, r *htt
 				}
 
 				// Save tag
-				err = group.Insert(handlerData.Db, handlerData.User)
+				err = models.WithChanges(handlerData.Db, func(tx *gorm.DB, changes *models.ChangeLog) error {
+					if err := group.Insert(tx, handlerData.User); err != nil {
+						return err
+					}
+
+					return changes.Record(namespace.ID, models.ChangeGroup, models.ChangeCreated, group.ID, group.Name)
+				})
+
 				if err != nil {
 					return err
 				}
+
+				audit(handlerData, r, attributeAuditEntry(models.AuditAttrCreate, models.AuditTargetGroup, group.ID, group.Name, namespace))
 			}
 		}
 	}
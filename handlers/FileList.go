@@ -23,7 +23,7 @@ func ListFilesHandler(handlerData web.HandlerData, w http.ResponseWriter, r *htt
 		namespace = models.FindNamespace(handlerData.Db, request.Attributes.Namespace, handlerData.User)
 
 		// Handle namespace errors (not found || no access)
-		if !handleNamespaceErorrs(namespace, handlerData.User, w) {
+		if !handleNamespaceErorrs(namespace, handlerData.User, false, w) {
 			return nil
 		}
 	}
@@ -48,10 +48,10 @@ func ListFilesHandler(handlerData web.HandlerData, w http.ResponseWriter, r *htt
 	}
 
 	if request.AllNamespaces {
-		// Join to filter by namespace creator
+		// Join to filter by the readable namespaces
 		loaded = loaded.
 			Joins("INNER JOIN namespaces ON namespaces.id = files.namespace_id").
-			Where("namespaces.creator = ?", handlerData.User.ID)
+			Scopes(models.ReadableNamespaces(handlerData.User))
 	} else {
 		// Just select the specified namespace
 		loaded = loaded.Where("namespace_id = ?", namespace.ID)
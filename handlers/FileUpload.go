@@ -1,23 +1,53 @@
 package handlers
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/metrics"
 	"github.com/DataManager-Go/DataManagerServer/models"
 	libdm "github.com/DataManager-Go/libdatamanager"
 	"github.com/JojiiOfficial/gaw"
 	"github.com/gabriel-vasile/mimetype"
-	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
-//UploadfileHandler handler for uploading files
+// Uploads in progress. Waited for on shutdown
+var runningUploads int64
+
+// WaitForUploads waits for running uploads until ctx is
+// done. Returns false if uploads are still running
+func WaitForUploads(ctx context.Context) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&runningUploads) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+// UploadfileHandler handler for uploading files
 func UploadfileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	metrics.ActiveUploads.Inc()
+	defer metrics.ActiveUploads.Dec()
+
+	atomic.AddInt64(&runningUploads, 1)
+	defer atomic.AddInt64(&runningUploads, -1)
+
 	request, err := parseUploadRequest(r)
 	if err != nil {
 		return err
@@ -32,10 +62,14 @@ func UploadfileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *ht
 	var file *models.File
 	var needNewFile = request.ReplaceFileByID == 0
 
+	// States of replaced files for the audit log
+	var replaced []auditFileState
+	var oldNamespaceID uint
+
 	// Replace with same name
 	if request.ReplaceEqualNames {
 		namespace = models.FindNamespace(handlerData.Db, request.Attributes.Namespace, handlerData.User)
-		if !handleNamespaceErorrs(namespace, handlerData.User, w) {
+		if !handleNamespaceErorrs(namespace, handlerData.User, true, w) {
 			return nil
 		}
 
@@ -54,6 +88,8 @@ func UploadfileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *ht
 				if err != nil {
 					return err
 				}
+
+				replaced = append(replaced, newAuditFileState(&files[i]))
 			}
 
 		}
@@ -66,6 +102,9 @@ func UploadfileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *ht
 			return RErrNotFound.Prepend("File")
 		}
 
+		replaced = append(replaced, newAuditFileState(file))
+		oldNamespaceID = file.NamespaceID
+
 		// Use new name if set
 		if len(request.Name) > 0 {
 			file.Name = request.Name
@@ -106,7 +145,7 @@ func UploadfileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *ht
 	}
 
 	// Check if namespace is valid and user has access to it
-	if !handleNamespaceErorrs(namespace, handlerData.User, w) {
+	if !handleNamespaceErorrs(namespace, handlerData.User, true, w) {
 		return nil
 	}
 
@@ -133,14 +172,14 @@ func UploadfileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *ht
 			size, checksum, err := readMultipartToFile(f, r.Body, w)
 
 			// Close file and log error only
-			LogError(f.Close())
+			handlerData.LogError(f.Close())
 
 			// success is false if the calculated
 			// and provided hash are not equal
 			if err != nil {
 				// Only shredder file if not in replace mode
 				if request.ReplaceFileByID == 0 {
-					go models.ShredderFile(localFile, -1)
+					models.StartShredJob(handlerData.Db, localFile, -1)
 				}
 
 				// If error is a timeout error, send timeout error and close connectio
@@ -174,23 +213,58 @@ func UploadfileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *ht
 	// Detect mime type
 	mime, err := mimetype.DetectFile(handlerData.Config.GetStorageFile(file.LocalName))
 	if err != nil {
-		log.Info("Can't detect mime: ", err.Error())
+		handlerData.Log.Info("Can't detect mime: ", err.Error())
 	} else {
 		file.FileType = strings.Split(mime.String(), ";")[0]
 	}
 
-	if needNewFile {
-		// Insert file to DB
-		err = file.Insert(handlerData.Db, handlerData.User)
-	} else {
-		// Update file
-		err = file.Save(handlerData.Db)
-	}
+	err = models.WithChanges(handlerData.Db, func(tx *gorm.DB, changes *models.ChangeLog) error {
+		if needNewFile {
+			// Insert file to DB
+			if err := file.Insert(tx, handlerData.User); err != nil {
+				return err
+			}
+		} else {
+			// Update file
+			if err := file.Save(tx); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case request.ReplaceFileByID == 0:
+			return changes.Record(namespace.ID, models.ChangeFile, models.ChangeCreated, file.ID, file.Name)
+		case oldNamespaceID != namespace.ID:
+			// Replacing moved the file
+			if err := changes.Record(oldNamespaceID, models.ChangeFile, models.ChangeDeleted, file.ID, file.Name); err != nil {
+				return err
+			}
+
+			return changes.Record(namespace.ID, models.ChangeFile, models.ChangeCreated, file.ID, file.Name)
+		default:
+			return changes.Record(namespace.ID, models.ChangeFile, models.ChangeUpdated, file.ID, file.Name)
+		}
+	})
 
 	if err != nil {
 		return err
 	}
 
+	metrics.UploadedBytes.Add(float64(file.FileSize))
+
+	if len(replaced) > 0 {
+		audit(handlerData, r, models.FileAuditEntry(models.AuditFileReplace, file).WithChange(replaced, newAuditFileState(file)))
+		triggerWebhooks(handlerData, models.WebhookReplaced, file)
+	} else {
+		audit(handlerData, r, models.FileAuditEntry(models.AuditFileUpload, file).WithChange(nil, newAuditFileState(file)))
+		triggerWebhooks(handlerData, models.WebhookUploaded, file)
+	}
+
+	if request.Public {
+		audit(handlerData, r, models.FileAuditEntry(models.AuditFilePublish, file).WithChange(nil, file.PublicFilename.String))
+		triggerWebhooks(handlerData, models.WebhookPublished, file)
+	}
+
 	sendResponse(w, libdm.ResponseSuccess, "", libdm.UploadResponse{
 		FileID:         file.ID,
 		Filename:       file.Name,
@@ -203,6 +277,30 @@ func UploadfileHandler(handlerData web.HandlerData, w http.ResponseWriter, r *ht
 	return nil
 }
 
+// State of an uploaded or replaced file
+type auditFileState struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Namespace string `json:"ns,omitempty"`
+	Checksum  string `json:"checksum,omitempty"`
+	Size      int64  `json:"size"`
+}
+
+func newAuditFileState(file *models.File) auditFileState {
+	state := auditFileState{
+		ID:       file.ID,
+		Name:     file.Name,
+		Checksum: file.Checksum,
+		Size:     file.FileSize,
+	}
+
+	if file.Namespace != nil {
+		state.Namespace = file.Namespace.Name
+	}
+
+	return state
+}
+
 func parseUploadRequest(r *http.Request) (*libdm.UploadRequestStruct, error) {
 	var request libdm.UploadRequestStruct
 
@@ -238,6 +336,25 @@ func validateUploadRequest(user *models.User, request *libdm.UploadRequestStruct
 		return RErrNotAllowed
 	}
 
+	// Replacing files deletes the old ones
+	if request.ReplaceEqualNames || request.ReplaceFileByID > 0 {
+		if err := checkPermission(user, models.PermissionDeleteFiles, "replace files"); err != nil {
+			return err
+		}
+	}
+
+	if request.Public {
+		if err := checkPermission(user, models.PermissionPublish, "publish files"); err != nil {
+			return err
+		}
+	}
+
+	if len(request.Attributes.Tags) > 0 || len(request.Attributes.Groups) > 0 {
+		if err := checkPermission(user, models.PermissionManageAttributes, "manage tags and groups"); err != nil {
+			return err
+		}
+	}
+
 	// Validating request, for desired upload Type
 	switch request.UploadType {
 	case libdm.FileUploadType:
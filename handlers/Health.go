@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/storage"
+	libdm "github.com/DataManager-Go/libdatamanager"
+)
+
+// Health states
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+var (
+	// Closed once the server shuts down
+	shutdown     = make(chan struct{})
+	shutdownOnce sync.Once
+)
+
+// HealthCheck result of a single readiness check
+type HealthCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// HealthResponse response of the health and readiness endpoints
+type HealthResponse struct {
+	Status       string                 `json:"status"`
+	ShuttingDown bool                   `json:"shuttingDown,omitempty"`
+	FreeSpace    uint64                 `json:"freeSpace,omitempty"`
+	Checks       map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// SetShuttingDown lets the readiness endpoint report not ready to stop
+// getting new requests and ends long running requests like change streams
+func SetShuttingDown() {
+	shutdownOnce.Do(func() {
+		close(shutdown)
+	})
+}
+
+// Returns true if the server is shutting down
+func isShuttingDown() bool {
+	select {
+	case <-shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// HealthHandler reports that the process is alive
+func HealthHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	sendResponse(w, libdm.ResponseSuccess, "", HealthResponse{
+		Status: healthOK,
+	})
+
+	return nil
+}
+
+// ReadyHandler reports if the server can handle requests. It's
+// not ready if the database or the file store aren't usable
+func ReadyHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	response := HealthResponse{
+		Status:       healthOK,
+		ShuttingDown: isShuttingDown(),
+		Checks:       make(map[string]HealthCheck),
+	}
+
+	response.Checks["database"] = newHealthCheck(checkDatabase(handlerData))
+	response.Checks["filestore"] = newHealthCheck(checkFileStore(handlerData))
+
+	var err error
+	response.FreeSpace, err = checkFreeSpace(handlerData)
+	response.Checks["freespace"] = newHealthCheck(err)
+
+	ready := !response.ShuttingDown
+	for _, check := range response.Checks {
+		ready = ready && check.OK
+	}
+
+	if !ready {
+		response.Status = healthUnavailable
+		sendResponse(w, libdm.ResponseError, "", response, http.StatusServiceUnavailable)
+		return nil
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", response)
+	return nil
+}
+
+func newHealthCheck(err error) HealthCheck {
+	if err != nil {
+		return HealthCheck{Error: err.Error()}
+	}
+
+	return HealthCheck{OK: true}
+}
+
+// Check if the database is reachable
+func checkDatabase(handlerData web.HandlerData) error {
+	_, err := storage.CheckConnection(handlerData.Db, handlerData.Config)
+	return err
+}
+
+// Check if files can be written to the file store
+func checkFileStore(handlerData web.HandlerData) error {
+	f, err := ioutil.TempFile(handlerData.Config.Server.PathConfig.FileStore, ".readycheck")
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Check if the file store has the required free space. Systems which can't
+// determine the free space are only checked if a minimum is required
+func checkFreeSpace(handlerData web.HandlerData) (uint64, error) {
+	minFree := handlerData.Config.Server.PathConfig.MinFreeSpace
+
+	free, err := storage.FreeSpace(handlerData.Config.Server.PathConfig.FileStore)
+	if err != nil {
+		if err == storage.ErrFreeSpaceNotSupported && minFree == 0 {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	if free < minFree {
+		return free, fmt.Errorf("%d bytes free, %d required", free, minFree)
+	}
+
+	return free, nil
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	libdm "github.com/DataManager-Go/libdatamanager"
+	"github.com/JojiiOfficial/gaw"
+	"github.com/gorilla/mux"
+)
+
+// InviteRequest request to create or revoke an invite
+type InviteRequest struct {
+	ID       uint   `json:"id,omitempty"`
+	RoleID   uint   `json:"role,omitempty"`
+	MaxUses  uint   `json:"uses,omitempty"`
+	ValidFor string `json:"validFor,omitempty"`
+}
+
+// InviteItem an invite without its code
+type InviteItem struct {
+	ID        uint       `json:"id"`
+	Creator   string     `json:"creator"`
+	RoleID    uint       `json:"roleID"`
+	Role      string     `json:"role"`
+	MaxUses   uint       `json:"maxUses"`
+	Uses      uint       `json:"uses"`
+	Created   time.Time  `json:"created"`
+	ExpiresAt *time.Time `json:"expires,omitempty"`
+	Expired   bool       `json:"expired"`
+}
+
+// InviteCreateResponse response containing a new invite code
+type InviteCreateResponse struct {
+	InviteItem
+	Code string `json:"code"`
+}
+
+// InviteListResponse response containing invites
+type InviteListResponse struct {
+	Invites []InviteItem `json:"invites"`
+}
+
+// InviteHandler handler for invite actions (create/revoke)
+func InviteHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	action := mux.Vars(r)["action"]
+	if !gaw.IsInStringArray(action, []string{"create", "revoke"}) {
+		return RErrBadRequest
+	}
+
+	if !handlerData.User.CanCreateInvites() {
+		return RErrNotAllowed.Append("to invite users")
+	}
+
+	var request InviteRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	if action == "create" {
+		return createInvite(handlerData, w, r, request)
+	}
+
+	invite, err := models.FindInvite(handlerData.Db, request.ID)
+	if err != nil {
+		if err == models.ErrorInviteNotFound {
+			return RErrNotFound.Prepend("Invite")
+		}
+
+		return err
+	}
+
+	// Users can only revoke their own invites
+	if invite.CreatorID != handlerData.User.ID && !handlerData.User.IsAdmin() {
+		return RErrNotFound.Prepend("Invite")
+	}
+
+	if err = invite.Revoke(handlerData.Db); err != nil {
+		return err
+	}
+
+	handlerData.Log.WithField("user", handlerData.User.Username).Infof("Revoked invite %d", invite.ID)
+	audit(handlerData, r, models.AuditEntry{
+		Action:     models.AuditInviteRevoke,
+		TargetType: models.AuditTargetInvite,
+		TargetID:   invite.ID,
+	})
+
+	sendResponse(w, libdm.ResponseSuccess, "", nil)
+	return nil
+}
+
+// Create a new invite
+func createInvite(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request, request InviteRequest) error {
+	var validFor time.Duration
+	if len(request.ValidFor) > 0 {
+		var err error
+		if validFor, err = time.ParseDuration(request.ValidFor); err != nil || validFor < 0 {
+			return RErrInvalid.Prepend("Validity")
+		}
+	}
+
+	// Only admins can create invites which never expire
+	if validFor == 0 && !handlerData.User.IsAdmin() {
+		return RErrMissing.Prepend("Validity")
+	}
+
+	if request.MaxUses == 0 {
+		request.MaxUses = 1
+	}
+
+	// Use the default role if none was set
+	roleID := request.RoleID
+	if roleID == 0 {
+		roleID = handlerData.Config.Server.Roles.DefaultRole
+	}
+
+	role, err := models.FindRole(handlerData.Db, roleID)
+	if err != nil {
+		if err == models.ErrorRoleNotFound {
+			return RErrNotFound.Prepend("Role")
+		}
+
+		return err
+	}
+
+	if !handlerData.User.CanAssignRole(role) {
+		return RErrNotAllowed.Append("to invite users with this role")
+	}
+
+	invite, code, err := models.CreateInvite(handlerData.Db, handlerData.User, role, request.MaxUses, validFor)
+	if err != nil {
+		return err
+	}
+
+	handlerData.Log.WithField("user", handlerData.User.Username).Infof("Created invite %d for role '%s'", invite.ID, role.RoleName)
+	audit(handlerData, r, models.AuditEntry{
+		Action:     models.AuditInvite,
+		TargetType: models.AuditTargetInvite,
+		TargetID:   invite.ID,
+	}.WithChange(nil, role.RoleName))
+
+	sendResponse(w, libdm.ResponseSuccess, "", InviteCreateResponse{
+		InviteItem: inviteItem(invite),
+		Code:       code,
+	})
+
+	return nil
+}
+
+// InviteListHandler lists the invites of a user. Admins get all invites
+func InviteListHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	if !handlerData.User.CanCreateInvites() {
+		return RErrNotAllowed.Append("to invite users")
+	}
+
+	creatorID := handlerData.User.ID
+	if handlerData.User.IsAdmin() {
+		creatorID = 0
+	}
+
+	invites, err := models.GetInvites(handlerData.Db, creatorID)
+	if err != nil {
+		return err
+	}
+
+	response := InviteListResponse{
+		Invites: make([]InviteItem, len(invites)),
+	}
+
+	for i := range invites {
+		response.Invites[i] = inviteItem(&invites[i])
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", response)
+	return nil
+}
+
+// Build the InviteItem for an invite
+func inviteItem(invite *models.Invite) InviteItem {
+	item := InviteItem{
+		ID:      invite.ID,
+		RoleID:  invite.RoleID,
+		MaxUses: invite.MaxUses,
+		Uses:    invite.Uses,
+		Created: invite.CreatedAt,
+		Expired: invite.IsExpired(),
+	}
+
+	if invite.Creator != nil {
+		item.Creator = invite.Creator.Username
+	}
+
+	if invite.Role != nil {
+		item.Role = invite.Role.RoleName
+	}
+
+	if !invite.ExpiresAt.IsZero() {
+		item.ExpiresAt = &invite.ExpiresAt
+	}
+
+	return item
+}
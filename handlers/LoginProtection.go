@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	"gorm.io/gorm"
+)
+
+// Return an error and set the Retry-After header
+// if one of the subjects is locked out
+func checkLockout(handlerData web.HandlerData, w http.ResponseWriter, subjects ...string) error {
+	if !handlerData.Config.Server.LoginProtection.Enabled {
+		return nil
+	}
+
+	remaining, err := models.GetLockout(handlerData.Db, subjects...)
+	if err != nil {
+		return err
+	}
+
+	if remaining > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+		return RErrTooManyAttempts
+	}
+
+	return nil
+}
+
+// Count a failed attempt for the ip and the username if set
+func registerFailedAttempt(handlerData web.HandlerData, ip, username string) {
+	protection := handlerData.Config.Server.LoginProtection
+	if !protection.Enabled {
+		return
+	}
+
+	handlerData.LogError(models.RegisterLoginFailure(handlerData.Db, handlerData.Config, models.LockoutSubjectIP(ip), protection.MaxFailuresPerIP))
+
+	if len(username) > 0 {
+		handlerData.LogError(models.RegisterLoginFailure(handlerData.Db, handlerData.Config, models.LockoutSubjectUser(username), protection.MaxFailuresPerUser))
+	}
+}
+
+// Convert an error returned by a login into a request
+// error and count failed attempts
+func handleLoginError(handlerData web.HandlerData, ip, username string, err error) error {
+	switch err {
+	case models.ErrorInvalidCredentials, gorm.ErrRecordNotFound:
+		registerFailedAttempt(handlerData, ip, username)
+	case models.ErrorInvalidSecondFactor:
+		registerFailedAttempt(handlerData, ip, username)
+		return RErrInvalid.Prepend("Second factor").WithCode(http.StatusUnauthorized)
+	case models.ErrorSecondFactorRequired:
+		return RErrSecondFactorRequired
+	case models.ErrorSecondFactorEnrollment:
+		return RErrSecondFactorEnrollment
+	case models.ErrorUserDisabled:
+		return RErrUserDisabled
+	default:
+		handlerData.LogError(err)
+	}
+
+	return RErrInvalid.Append("credentials")
+}
+
+// Forget the failed attempts of a user after a successful login
+func resetFailedAttempts(handlerData web.HandlerData, username string) {
+	if !handlerData.Config.Server.LoginProtection.Enabled {
+		return
+	}
+
+	_, err := models.ResetLoginFailures(handlerData.Db, models.LockoutSubjectUser(username))
+	handlerData.LogError(err)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/metrics"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Records the status code and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += int64(n)
+	return n, err
+}
+
+// Flush supports streaming responses
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Returns the status code sent. Responses
+// without an explicit status are sent with 200
+func (rec *statusRecorder) getStatus() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+
+	return rec.status
+}
+
+// Record a handled request in the metrics
+func (rec *statusRecorder) observe(route string, start time.Time) {
+	code := strconv.Itoa(rec.getStatus())
+	metrics.Requests.WithLabelValues(route, code).Inc()
+	metrics.RequestDuration.WithLabelValues(route, code).Observe(time.Since(start).Seconds())
+}
+
+// MetricsHandler serves the Prometheus metrics. Requires
+// the configured token as bearer token if one is set
+func MetricsHandler(config *models.Config) http.Handler {
+	handler := promhttp.Handler()
+	token := config.Webserver.Metrics.Token
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(token) > 0 && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
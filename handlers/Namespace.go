@@ -2,13 +2,13 @@ package handlers
 
 import (
 	"net/http"
-	"strings"
 
 	"github.com/DataManager-Go/DataManagerServer/handlers/web"
 	"github.com/DataManager-Go/DataManagerServer/models"
 	libdm "github.com/DataManager-Go/libdatamanager"
 	"github.com/JojiiOfficial/gaw"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
 // NamespaceActionHandler handler for namespace actions (create/update/delete)
@@ -32,23 +32,29 @@ func NamespaceActionHandler(handlerData web.HandlerData, w http.ResponseWriter,
 	}
 
 	// Check permissions
-	if !handlerData.User.CanCreateNamespaces() {
+	if action == "create" && !handlerData.User.CanCreateNamespaces() {
 		return RErrNotAllowed.Append("to create user namespaces")
 	}
 
-	// Find namespace
-	namespace := models.FindNamespace(handlerData.Db, request.Namespace, handlerData.User)
+	// Deleting a namespace deletes its files
+	if action == "delete" {
+		if err := checkPermission(handlerData.User, models.PermissionDeleteFiles, "delete files"); err != nil {
+			return err
+		}
+	}
 
 	// Do action type related checks
+	var namespace *models.Namespace
 	if action == "create" {
 		// Check if namespace already exists
-		if namespace != nil && namespace.ID != 0 {
+		if _, err := models.FindNamespaceByName(handlerData.Db, handlerData.User.GetNamespaceName(request.Namespace)); err == nil {
 			return RErrAlreadyExists.Prepend("Namespace")
 		}
 	} else {
-		// Error if namespace not found/valid
-		if !namespace.IsValid() {
-			return RErrNotFound.Prepend("Namespace")
+		// Renaming and deleting requires write access
+		namespace = models.FindNamespace(handlerData.Db, request.Namespace, handlerData.User)
+		if !handleNamespaceErorrs(namespace, handlerData.User, true, w) {
+			return nil
 		}
 
 		// on update, check if new name is not empty
@@ -57,50 +63,80 @@ func NamespaceActionHandler(handlerData web.HandlerData, w http.ResponseWriter,
 		}
 	}
 
-	var err error
+	var oldName string
 
-	switch action {
-	case "create":
-		{
-			// Create and insert namespaceo
-			namespace = &models.Namespace{
-				Name:   handlerData.User.GetNamespaceName(request.Namespace),
-				User:   handlerData.User,
-				UserID: handlerData.User.ID,
-			}
+	err := models.WithChanges(handlerData.Db, func(tx *gorm.DB, changes *models.ChangeLog) error {
+		switch action {
+		case "create":
+			{
+				// Create and insert namespaceo
+				namespace = &models.Namespace{
+					Name:   handlerData.User.GetNamespaceName(request.Namespace),
+					User:   handlerData.User,
+					UserID: handlerData.User.ID,
+				}
 
-			err = namespace.Create(handlerData.Db)
-		}
-	case "update":
-		{
-			newName := handlerData.User.GetNamespaceName(request.NewName)
-
-			// Check if namespace already exists. If the name is equal no the newname (ignoring case), accept new name since it can
-			// have different casing
-			newNS := models.FindNamespace(handlerData.Db, newName, handlerData.User)
-			if newNS != nil && strings.ToLower(request.NewName) != strings.ToLower(request.Namespace) {
-				return RErrAlreadyExists.Prepend("Namespace")
-			}
+				if err := namespace.Create(tx); err != nil {
+					return err
+				}
 
-			// Update namespace
-			namespace.Name = newName
-			err = handlerData.Db.Model(&models.Namespace{}).Save(namespace).Error
-		}
-	case "delete":
-		{
-			// Delete namespace
-			handlerData.Db.Delete(namespace)
-			handlerData.Db.Delete(&models.Tag{}, "namespace_id=?", namespace.ID)
-			handlerData.Db.Delete(&models.Group{}, "namespace_id=?", namespace.ID)
-			handlerData.Db.Delete(&models.File{}, "namespace_id=?", namespace.ID)
+				return changes.Record(namespace.ID, models.ChangeNamespace, models.ChangeCreated, namespace.ID, namespace.Name)
+			}
+		case "update":
+			{
+				// Keep the prefix of the owner if renaming foreign namespaces
+				var owner models.User
+				if err := tx.First(&owner, namespace.UserID).Error; err != nil {
+					return err
+				}
+
+				newName := owner.GetNamespaceName(request.NewName)
+
+				// Check if namespace already exists. Renaming a namespace to its
+				// own name is accepted since it can have a different casing
+				if newNS, findErr := models.FindNamespaceByName(tx, newName); findErr == nil && newNS.ID != namespace.ID {
+					return RErrAlreadyExists.Prepend("Namespace")
+				}
+
+				// Update namespace
+				oldName = namespace.Name
+				namespace.Name = newName
+				if err := tx.Model(namespace).Update("name", newName).Error; err != nil {
+					return err
+				}
+
+				return changes.Record(namespace.ID, models.ChangeNamespace, models.ChangeUpdated, namespace.ID, namespace.Name)
+			}
+		default:
+			{
+				// Delete namespace
+				tx.Delete(namespace)
+				tx.Delete(&models.Tag{}, "namespace_id=?", namespace.ID)
+				tx.Delete(&models.Group{}, "namespace_id=?", namespace.ID)
+				tx.Delete(&models.File{}, "namespace_id=?", namespace.ID)
+				if err := models.DeleteWebhooks(tx, models.Webhook{NamespaceID: namespace.ID}); err != nil {
+					return err
+				}
+
+				return changes.Record(namespace.ID, models.ChangeNamespace, models.ChangeDeleted, namespace.ID, namespace.Name)
+			}
 		}
-	}
+	})
 
 	// On any errors
 	if err != nil {
 		return err
 	}
 
+	switch action {
+	case "create":
+		audit(handlerData, r, namespaceAuditEntry(models.AuditNSCreate, namespace))
+	case "update":
+		audit(handlerData, r, namespaceAuditEntry(models.AuditNSRename, namespace).WithChange(oldName, namespace.Name))
+	case "delete":
+		audit(handlerData, r, namespaceAuditEntry(models.AuditNSDelete, namespace))
+	}
+
 	sendResponse(w, libdm.ResponseSuccess, "", libdm.StringResponse{
 		String: namespace.Name,
 	})
@@ -110,7 +146,7 @@ func NamespaceActionHandler(handlerData web.HandlerData, w http.ResponseWriter,
 
 // NamespaceListHandler lists namespaces
 func NamespaceListHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
-	namespaces, err := models.FindUserNamespaces(handlerData.Db, handlerData.User)
+	namespaces, err := models.FindReadableNamespaces(handlerData.Db, handlerData.User)
 	if err != nil {
 		return err
 	}
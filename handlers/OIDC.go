@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	libdm "github.com/DataManager-Go/libdatamanager"
+)
+
+// Cookie binding a started login to the browser
+const oidcStateCookie = "dm_oidc_state"
+
+// OIDCDeviceResponse response for a started device login
+type OIDCDeviceResponse struct {
+	DeviceCode              string `json:"deviceCode"`
+	UserCode                string `json:"userCode"`
+	VerificationURI         string `json:"verificationURI"`
+	VerificationURIComplete string `json:"verificationURIComplete,omitempty"`
+	ExpiresIn               int    `json:"expiresIn"`
+	Interval                int    `json:"interval"`
+}
+
+// OIDCDeviceTokenRequest request for polling a device login
+type OIDCDeviceTokenRequest struct {
+	DeviceCode string `json:"deviceCode"`
+	MachineID  string `json:"mid,omitempty"`
+}
+
+// OIDCLoginHandler redirects to the identity provider
+func OIDCLoginHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	authURL, state, err := models.StartOIDCLogin(r.Context(), handlerData.Db, handlerData.Config, r.URL.Query().Get("mid"))
+	if err != nil {
+		return handleOIDCError(err)
+	}
+
+	// Bind the login to this browser. Lax is required
+	// to get the cookie on the redirect of the provider
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/oidc/callback",
+		MaxAge:   int(models.OIDCStateLifetime.Seconds()),
+		Secure:   strings.HasPrefix(handlerData.Config.Server.OIDC.RedirectURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+	return nil
+}
+
+// OIDCCallbackHandler finishes a login started by OIDCLoginHandler
+func OIDCCallbackHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+
+	// The provider declined the login
+	if len(query.Get("error")) > 0 {
+		return NewRequestError("Login declined: "+query.Get("error"), http.StatusUnauthorized)
+	}
+
+	if len(query.Get("state")) == 0 || len(query.Get("code")) == 0 {
+		return RErrBadRequest
+	}
+
+	// Only the browser which started the login can finish it
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		return handleOIDCError(models.ErrorOIDCInvalidState)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/oidc/callback",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	user, session, err := models.FinishOIDCLogin(r.Context(), handlerData.Db, handlerData.Config, query.Get("state"), query.Get("code"), GetClientIP(handlerData.Config, r))
+	if err != nil {
+		return handleOIDCError(err)
+	}
+
+	auditAs(handlerData, r, user, models.UserAuditEntry(models.AuditLogin, user).WithChange(nil, models.AuthSourceOIDC))
+
+	sendResponse(w, libdm.ResponseSuccess, "", libdm.LoginResponse{
+		Token:     session.Token,
+		Namespace: user.GetDefaultNamespaceName(),
+	})
+
+	return nil
+}
+
+// OIDCDeviceHandler starts a device login
+func OIDCDeviceHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	authorization, err := models.StartOIDCDeviceLogin(r.Context(), handlerData.Config)
+	if err != nil {
+		return handleOIDCError(err)
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", OIDCDeviceResponse{
+		DeviceCode:              authorization.DeviceCode,
+		UserCode:                authorization.UserCode,
+		VerificationURI:         authorization.VerificationURI,
+		VerificationURIComplete: authorization.VerificationURIComplete,
+		ExpiresIn:               authorization.ExpiresIn,
+		Interval:                authorization.Interval,
+	})
+
+	return nil
+}
+
+// OIDCDeviceTokenHandler returns a session token once
+// the device login was completed by the user
+func OIDCDeviceTokenHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request OIDCDeviceTokenRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	if len(request.DeviceCode) == 0 {
+		return RErrMissing.Prepend("Device code")
+	}
+
+	user, session, err := models.PollOIDCDeviceLogin(r.Context(), handlerData.Db, handlerData.Config, request.DeviceCode, request.MachineID, GetClientIP(handlerData.Config, r))
+	if err != nil {
+		return handleOIDCError(err)
+	}
+
+	auditAs(handlerData, r, user, models.UserAuditEntry(models.AuditLogin, user).WithChange(nil, models.AuthSourceOIDC))
+
+	sendResponse(w, libdm.ResponseSuccess, "", libdm.LoginResponse{
+		Token:     session.Token,
+		Namespace: user.GetDefaultNamespaceName(),
+	})
+
+	return nil
+}
+
+// Convert an error of an OIDC login into a request error
+func handleOIDCError(err error) error {
+	switch err {
+	case models.ErrorOIDCDisabled:
+		return RErrNotSupported.Prepend("This login method is")
+	case models.ErrorOIDCInvalidState:
+		return RErrInvalid.Prepend("Login state").WithCode(http.StatusBadRequest)
+	case models.ErrorOIDCPending:
+		return NewRequestError("Authorization pending", http.StatusPreconditionRequired)
+	case models.ErrorOIDCSlowDown:
+		return NewRequestError("Polling too fast", http.StatusTooManyRequests)
+	case models.ErrorOIDCDenied, models.ErrorInvalidCredentials:
+		return NewRequestError("Authorization denied or expired", http.StatusUnauthorized)
+	case models.ErrorOIDCMissingClaim:
+		return NewRequestError("Identity provider didn't return a username", http.StatusUnauthorized)
+	case models.ErrorUserAlreadyExists:
+		return RErrAlreadyExists.Prepend("User").WithCode(http.StatusConflict)
+	case models.ErrorUserDisabled:
+		return RErrUserDisabled
+	case models.ErrorExternalSecondFactor:
+		return RErrExternalSecondFactor
+	}
+
+	return err
+}
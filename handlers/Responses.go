@@ -22,10 +22,11 @@ func sendServerError(w http.ResponseWriter) {
 	sendResponse(w, libdm.ResponseError, "internal server error", nil, http.StatusInternalServerError)
 }
 
-//Return true on success
-func handleNamespaceErorrs(namespace *models.Namespace, user *models.User, w http.ResponseWriter) bool {
+//Return true on success. Checks for write access
+//unless write is false
+func handleNamespaceErorrs(namespace *models.Namespace, user *models.User, write bool, w http.ResponseWriter) bool {
 	// We already did a check
-	if namespace.Validated {
+	if namespace != nil && namespace.Validated {
 		return true
 	}
 
@@ -35,6 +36,16 @@ func handleNamespaceErorrs(namespace *models.Namespace, user *models.User, w htt
 		return false
 	}
 
+	// Check if user can read this namespace
+	if !write {
+		if !user.HasReadAccess(namespace) {
+			sendResponse(w, libdm.ResponseError, "Read permission denied for this namespace", nil, http.StatusForbidden)
+			return false
+		}
+
+		return true
+	}
+
 	// Check if user can access this namespace
 	if !user.HasAccess(namespace) {
 		fmt.Println("no access", user.ID, namespace.UserID)
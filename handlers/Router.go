@@ -43,6 +43,7 @@ const (
 	defaultRequest requestType = iota
 	sessionRequest
 	optionalTokenRequest
+	adminRequest
 )
 
 // Routes all REST routes
@@ -62,6 +63,21 @@ var (
 			HandlerFunc: Ping,
 			HandlerType: defaultRequest,
 		},
+		// Health
+		Route{
+			Name:        "healthz",
+			Pattern:     "/healthz",
+			Method:      GetMethod,
+			HandlerFunc: HealthHandler,
+			HandlerType: defaultRequest,
+		},
+		Route{
+			Name:        "readyz",
+			Pattern:     "/readyz",
+			Method:      GetMethod,
+			HandlerFunc: ReadyHandler,
+			HandlerType: defaultRequest,
+		},
 		// User
 		Route{
 			Name:        "login",
@@ -77,6 +93,105 @@ var (
 			HandlerFunc: Register,
 			HandlerType: defaultRequest,
 		},
+		// OIDC
+		Route{
+			Name:        "oidc login",
+			Pattern:     "/oidc/login",
+			Method:      GetMethod,
+			HandlerFunc: OIDCLoginHandler,
+			HandlerType: defaultRequest,
+		},
+		Route{
+			Name:        "oidc callback",
+			Pattern:     "/oidc/callback",
+			Method:      GetMethod,
+			HandlerFunc: OIDCCallbackHandler,
+			HandlerType: defaultRequest,
+		},
+		Route{
+			Name:        "oidc device",
+			Pattern:     "/oidc/device",
+			Method:      POSTMethod,
+			HandlerFunc: OIDCDeviceHandler,
+			HandlerType: defaultRequest,
+		},
+		Route{
+			Name:        "oidc device token",
+			Pattern:     "/oidc/device/token",
+			Method:      POSTMethod,
+			HandlerFunc: OIDCDeviceTokenHandler,
+			HandlerType: defaultRequest,
+		},
+		Route{
+			Name:        "logout",
+			Pattern:     "/user/logout",
+			Method:      POSTMethod,
+			HandlerFunc: LogoutHandler,
+			HandlerType: sessionRequest,
+		},
+		Route{
+			Name:        "list sessions",
+			Pattern:     "/user/sessions",
+			Method:      POSTMethod,
+			HandlerFunc: SessionListHandler,
+			HandlerType: sessionRequest,
+		},
+		Route{
+			Name:        "revoke session",
+			Pattern:     "/user/session/revoke",
+			Method:      POSTMethod,
+			HandlerFunc: SessionRevokeHandler,
+			HandlerType: sessionRequest,
+		},
+		Route{
+			Name:        "enroll 2fa",
+			Pattern:     "/user/2fa/enroll",
+			Method:      POSTMethod,
+			HandlerFunc: TOTPEnrollHandler,
+			HandlerType: defaultRequest,
+		},
+		Route{
+			Name:        "confirm 2fa",
+			Pattern:     "/user/2fa/confirm",
+			Method:      POSTMethod,
+			HandlerFunc: TOTPConfirmHandler,
+			HandlerType: defaultRequest,
+		},
+		Route{
+			Name:        "disable 2fa",
+			Pattern:     "/user/2fa/disable",
+			Method:      POSTMethod,
+			HandlerFunc: TOTPDisableHandler,
+			HandlerType: defaultRequest,
+		},
+		Route{
+			Name:        "change password",
+			Pattern:     "/user/password",
+			Method:      POSTMethod,
+			HandlerFunc: ChangePasswordHandler,
+			HandlerType: sessionRequest,
+		},
+		Route{
+			Name:        "rename user",
+			Pattern:     "/user/rename",
+			Method:      POSTMethod,
+			HandlerFunc: RenameHandler,
+			HandlerType: sessionRequest,
+		},
+		Route{
+			Name:        "delete account",
+			Pattern:     "/user/delete",
+			Method:      POSTMethod,
+			HandlerFunc: DeleteAccountHandler,
+			HandlerType: sessionRequest,
+		},
+		Route{
+			Name:        "export",
+			Pattern:     "/user/export",
+			Method:      POSTMethod,
+			HandlerFunc: ExportHandler,
+			HandlerType: sessionRequest,
+		},
 		Route{
 			Name:        "stats",
 			Pattern:     "/user/stats",
@@ -155,11 +270,137 @@ var (
 			HandlerFunc: NamespaceListHandler,
 			HandlerType: sessionRequest,
 		},
+
+		// Invites
+		Route{
+			Name:        "invite",
+			Pattern:     "/invite/{action}",
+			Method:      POSTMethod,
+			HandlerFunc: InviteHandler,
+			HandlerType: sessionRequest,
+		},
+		Route{
+			Name:        "invites",
+			Pattern:     "/invites",
+			Method:      POSTMethod,
+			HandlerFunc: InviteListHandler,
+			HandlerType: sessionRequest,
+		},
+
+		// Change feed
+		Route{
+			Name:        "changes",
+			Pattern:     "/changes",
+			Method:      POSTMethod,
+			HandlerFunc: ChangesHandler,
+			HandlerType: sessionRequest,
+		},
+		Route{
+			Name:        "change stream",
+			Pattern:     "/changes/stream",
+			Method:      GetMethod,
+			HandlerFunc: ChangeStreamHandler,
+			HandlerType: sessionRequest,
+		},
+
+		// Webhooks
+		Route{
+			Name:        "webhook deliveries",
+			Pattern:     "/webhook/deliveries",
+			Method:      POSTMethod,
+			HandlerFunc: WebhookDeliveriesHandler,
+			HandlerType: sessionRequest,
+		},
+		Route{
+			Name:        "webhook",
+			Pattern:     "/webhook/{action}",
+			Method:      POSTMethod,
+			HandlerFunc: WebhookHandler,
+			HandlerType: sessionRequest,
+		},
+		Route{
+			Name:        "webhooks",
+			Pattern:     "/webhooks",
+			Method:      POSTMethod,
+			HandlerFunc: WebhookListHandler,
+			HandlerType: sessionRequest,
+		},
+
+		// Audit log
+		Route{
+			Name:        "audit",
+			Pattern:     "/audit",
+			Method:      POSTMethod,
+			HandlerFunc: AuditHandler,
+			HandlerType: sessionRequest,
+		},
+
+		// Admin
+		Route{
+			Name:        "admin audit",
+			Pattern:     "/admin/audit",
+			Method:      POSTMethod,
+			HandlerFunc: AdminAuditHandler,
+			HandlerType: adminRequest,
+		},
+		Route{
+			Name:        "admin users",
+			Pattern:     "/admin/users",
+			Method:      POSTMethod,
+			HandlerFunc: AdminUserListHandler,
+			HandlerType: adminRequest,
+		},
+		Route{
+			Name:        "admin user",
+			Pattern:     "/admin/user/{action}",
+			Method:      POSTMethod,
+			HandlerFunc: AdminUserHandler,
+			HandlerType: adminRequest,
+		},
+		Route{
+			Name:        "admin lockouts",
+			Pattern:     "/admin/lockouts",
+			Method:      POSTMethod,
+			HandlerFunc: AdminLockoutListHandler,
+			HandlerType: adminRequest,
+		},
+		Route{
+			Name:        "admin clear lockout",
+			Pattern:     "/admin/lockout/clear",
+			Method:      POSTMethod,
+			HandlerFunc: AdminLockoutClearHandler,
+			HandlerType: adminRequest,
+		},
+		Route{
+			Name:        "admin roles",
+			Pattern:     "/admin/roles",
+			Method:      POSTMethod,
+			HandlerFunc: AdminRoleListHandler,
+			HandlerType: adminRequest,
+		},
+		Route{
+			Name:        "admin role",
+			Pattern:     "/admin/role/{action}",
+			Method:      POSTMethod,
+			HandlerFunc: AdminRoleHandler,
+			HandlerType: adminRequest,
+		},
+		Route{
+			Name:        "admin config reload",
+			Pattern:     "/admin/config/reload",
+			Method:      POSTMethod,
+			HandlerFunc: ConfigReloadHandler,
+			HandlerType: adminRequest,
+		},
 	}
 )
 
 // NewRouter create new router and its required components
 func NewRouter(config *models.Config, db *gorm.DB) *mux.Router {
+	if err := initAccessLog(config); err != nil {
+		log.Fatal(err)
+	}
+
 	handlerData := web.HandlerData{
 		Config: config,
 		Db:     db,
@@ -177,6 +418,11 @@ func NewRouter(config *models.Config, db *gorm.DB) *mux.Router {
 	// Adding custom routes
 	addCustomRoutes(router, &handlerData)
 
+	// Serve metrics if they have no own listener
+	if config.Webserver.Metrics.Enabled && len(config.Webserver.Metrics.ListenAddress) == 0 {
+		router.Handle("/metrics", MetricsHandler(config))
+	}
+
 	return router
 }
 
@@ -197,50 +443,65 @@ func addCustomRoutes(router *mux.Router, handlerData *web.HandlerData) {
 
 // RouteHandler logs stuff
 func RouteHandler(requestType requestType, handlerData *web.HandlerData, inner RouteFunction, name string) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	// Label for metrics and the access log
+	route := name
+	if len(route) == 0 {
+		route = "unnamed"
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Identify the request in all its log lines
+		requestID := getRequestID(r)
+		rw.Header().Set(requestIDHeader, requestID)
+
+		// Each request gets its own copy
+		// since the user is set per request
+		requestData := *handlerData
+		requestData.Config = models.LiveConfig()
+		requestData.Log = log.WithField("requestID", requestID)
+
+		body := &bodyCounter{ReadCloser: r.Body}
+		r.Body = body
+
 		defer func() {
 			if err := r.Body.Close(); err != nil {
-				log.Info(err)
+				requestData.Log.Info(err)
 			}
 		}()
 
-		// Only debug routes which have a names
-		needDebug := len(name) > 0
-		if needDebug {
-			log.Infof("[%s] %s\n", r.Method, name)
-		}
-
-		start := time.Now()
+		// Record the status code and size for metrics and the access log
+		w := &statusRecorder{ResponseWriter: rw}
+		defer func() {
+			w.observe(route, start)
+			logAccess(&requestData, r, w, body, requestID, route, start)
+		}()
 
-		if validateHeader(handlerData.Config, w, r) {
+		if validateHeader(&requestData, w, r) {
 			return
 		}
 
 		// Validate request by requestType
-		if !requestType.validate(handlerData, r, w) {
+		if !requestType.validate(&requestData, r, w) {
 			return
 		}
 
 		// Process request and handle its error
-		if err := inner(*handlerData, w, r); err != nil {
+		if err := inner(requestData, w, r); err != nil {
 			if e, ok := err.(*RequestError); ok {
 				// Send error response to user
 				sendResponse(w, libdatamanager.ResponseError, e.String(), "", e.ResponseCode)
 
 				// Log user errors on debugmode
 				if log.GetLevel() == log.DebugLevel {
-					LogError(err)
+					requestData.LogError(err)
 				}
 			} else {
 				sendServerError(w)
-				log.Error(err)
+				requestData.Log.Error(err)
 			}
 		}
-
-		// Print duration of processing
-		if needDebug {
-			printProcessingDuration(start)
-		}
 	})
 }
 
@@ -248,7 +509,7 @@ func RouteHandler(requestType requestType, handlerData *web.HandlerData, inner R
 // if validate returns false, the request has to abort
 func (requestType requestType) validate(handlerData *web.HandlerData, r *http.Request, w http.ResponseWriter) bool {
 	switch requestType {
-	case sessionRequest:
+	case sessionRequest, adminRequest:
 		{
 			// SessionRequest requires a valid session token
 			// which identifies a specific user
@@ -256,46 +517,79 @@ func (requestType requestType) validate(handlerData *web.HandlerData, r *http.Re
 			// Create an AuthHandler using r
 			authHandler := NewAuthHandler(r)
 
-			// Check Token validity by its length
-			if len(authHandler.GetBearer()) != 64 {
-				log.Error("Invalid token len %d", len(authHandler.GetBearer()))
-				sendResponse(w, libdm.ResponseError, "Invalid token", http.StatusUnauthorized)
-				return false
-			}
+			var user *models.User
+			var session *models.LoginSession
+			var err error
+
+			// Requests without a token can be authenticated by a trusted
+			// proxy or a client certificate. These have no persisted session
+			proxyUsername := getProxyUsername(handlerData.Config, r)
+			certUsername := authHandler.GetCertificateUsername(handlerData.Config.Webserver.HTTPS.ClientCertUsername)
+
+			if len(authHandler.GetBearer()) == 0 && (len(proxyUsername) > 0 || len(certUsername) > 0) {
+				if len(proxyUsername) > 0 {
+					user, err = models.GetProxyUser(handlerData.Db, handlerData.Config, proxyUsername)
+					if err == nil {
+						err = user.CheckExternalSecondFactor(handlerData.Config.Server.ProxyAuth.TrustExternal2FA)
+					}
+				} else {
+					user, err = models.FindActiveUser(handlerData.Db, certUsername)
+					if err == nil {
+						err = user.CheckExternalSecondFactor(handlerData.Config.Webserver.HTTPS.TrustClientCert2FA)
+					}
+				}
+
+				if err == models.ErrorExternalSecondFactor {
+					handlerData.Log.Warnf("Rejected external login of '%s' since its role requires 2FA", user.Username)
+					sendResponse(w, libdm.ResponseError, RErrExternalSecondFactor.String(), nil, http.StatusUnauthorized)
+					return false
+				}
 
-			// Try to retrieve the user by the requestToken
-			user, err := models.GetUserFromSession(handlerData.Db, authHandler.GetBearer())
-			if LogError(err) || user == nil {
-				if user == nil && err == nil {
-					log.Error("Can't get user")
+				if handlerData.LogError(err) {
+					sendResponse(w, libdm.ResponseError, "Invalid user", nil, http.StatusUnauthorized)
+					return false
 				}
 
-				sendResponse(w, libdm.ResponseError, "Invalid token", http.StatusUnauthorized)
+				session = &models.LoginSession{User: user, UserID: user.ID}
+			} else {
+				// Check Token validity by its length
+				if len(authHandler.GetBearer()) != 64 {
+					handlerData.Log.Errorf("Invalid token len %d", len(authHandler.GetBearer()))
+					sendResponse(w, libdm.ResponseError, "Invalid token", nil, http.StatusUnauthorized)
+					return false
+				}
+
+				// Try to retrieve the user by the requestToken
+				user, session, err = models.GetUserFromSession(handlerData.Db, handlerData.Config, authHandler.GetBearer(), GetClientIP(handlerData.Config, r))
+				if handlerData.LogError(err) || user == nil {
+					if user == nil && err == nil {
+						handlerData.Log.Error("Can't get user")
+					}
+
+					sendResponse(w, libdm.ResponseError, "Invalid token", nil, http.StatusUnauthorized)
+					return false
+				}
+			}
+
+			// Admin routes require an admin role
+			if requestType == adminRequest && !user.IsAdmin() {
+				sendResponse(w, libdm.ResponseError, RErrPermissionDenied.String(), nil, http.StatusForbidden)
 				return false
 			}
 
 			// Set the handlerData.User which is
 			// required by all endpoint functions
 			handlerData.User = user
+			handlerData.Session = session
 		}
 	}
 
 	return true
 }
 
-// Prints the duration of handling the function
-func printProcessingDuration(startTime time.Time) {
-	dur := time.Since(startTime)
-
-	if dur < 1500*time.Millisecond {
-		log.Debugf("Duration: %s\n", dur.String())
-	} else if dur > 1500*time.Millisecond {
-		log.Warningf("Duration: %s\n", dur.String())
-	}
-}
-
 // Return true on error
-func validateHeader(config *models.Config, w http.ResponseWriter, r *http.Request) bool {
+func validateHeader(handlerData *web.HandlerData, w http.ResponseWriter, r *http.Request) bool {
+	config := handlerData.Config
 	headerSize := gaw.GetHeaderSize(r.Header)
 
 	// Send error if header are too big. MaxHeaderLength is stored in b
@@ -304,7 +598,7 @@ func validateHeader(config *models.Config, w http.ResponseWriter, r *http.Reques
 		w.WriteHeader(http.StatusRequestEntityTooLarge)
 		fmt.Fprint(w, "413 request too large")
 
-		log.Warnf("Got request with %db headers. Maximum allowed are %db\n", headerSize, config.Webserver.MaxHeaderLength)
+		handlerData.Log.Warnf("Got request with %db headers. Maximum allowed are %db\n", headerSize, config.Webserver.MaxHeaderLength)
 		return true
 	}
 
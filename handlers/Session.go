@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	libdm "github.com/DataManager-Go/libdatamanager"
+	"gorm.io/gorm"
+)
+
+// SessionItem a login session of a user
+type SessionItem struct {
+	ID        uint      `json:"id"`
+	MachineID string    `json:"mid,omitempty"`
+	CreatedAt time.Time `json:"created"`
+	LastUsed  time.Time `json:"lastUsed"`
+	IP        string    `json:"ip"`
+	Requests  int64     `json:"requests"`
+	Current   bool      `json:"current"`
+}
+
+// SessionListResponse response containing all sessions of a user
+type SessionListResponse struct {
+	Sessions []SessionItem `json:"sessions"`
+}
+
+// SessionRevokeRequest request to revoke a single or all other sessions
+type SessionRevokeRequest struct {
+	ID        uint `json:"id,omitempty"`
+	AllOthers bool `json:"allOthers,omitempty"`
+}
+
+// LogoutHandler revokes the session used for the request
+func LogoutHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	// Requests authenticated by a proxy or certificate have no session
+	if handlerData.Session.ID == 0 {
+		return RErrNotSupported.Prepend("Logging out without a session is")
+	}
+
+	if err := handlerData.Session.Revoke(handlerData.Db); err != nil {
+		return err
+	}
+
+	audit(handlerData, r, models.UserAuditEntry(models.AuditLogout, handlerData.User))
+
+	sendResponse(w, libdm.ResponseSuccess, "", nil)
+	return nil
+}
+
+// SessionListHandler lists all sessions of the user
+func SessionListHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	sessions, err := models.GetUserSessions(handlerData.Db, handlerData.User.ID)
+	if err != nil {
+		return err
+	}
+
+	response := SessionListResponse{
+		Sessions: make([]SessionItem, len(sessions)),
+	}
+
+	for i := range sessions {
+		response.Sessions[i] = SessionItem{
+			ID:        sessions[i].ID,
+			MachineID: sessions[i].MachineID,
+			CreatedAt: sessions[i].CreatedAt,
+			LastUsed:  sessions[i].LastUsed,
+			IP:        sessions[i].IP,
+			Requests:  sessions[i].Requests,
+			Current:   sessions[i].ID == handlerData.Session.ID,
+		}
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", response)
+	return nil
+}
+
+// SessionRevokeHandler revokes a single or all other sessions of the user
+func SessionRevokeHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request SessionRevokeRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	// Revoke all sessions except the current one
+	if request.AllOthers {
+		count, err := models.RevokeUserSessions(handlerData.Db, handlerData.User.ID, handlerData.Session.ID)
+		if err != nil {
+			return err
+		}
+
+		sendResponse(w, libdm.ResponseSuccess, "", libdm.CountResponse{
+			Count: uint32(count),
+		})
+		return nil
+	}
+
+	if request.ID == 0 {
+		return RErrMissing.Prepend("Session ID")
+	}
+
+	// Find session. Only allow revoking own sessions
+	session, err := models.FindUserSession(handlerData.Db, handlerData.User.ID, request.ID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return RErrNotFound.Prepend("Session")
+		}
+
+		return err
+	}
+
+	if err = session.Revoke(handlerData.Db); err != nil {
+		return err
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", libdm.CountResponse{
+		Count: 1,
+	})
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	libdm "github.com/DataManager-Go/libdatamanager"
+)
+
+// TOTPEnrollResponse response for a TOTP enrollment
+type TOTPEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"uri"`
+}
+
+// TOTPConfirmResponse response containing the
+// recovery codes of a confirmed TOTP secret
+type TOTPConfirmResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// TOTPEnrollHandler generates a new TOTP secret.
+// Credentials are used instead of a session, so users whose role
+// requires 2FA are able to enroll before their first login
+func TOTPEnrollHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request LoginRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	user, err := authenticateCredentials(handlerData, w, r, request)
+	if err != nil {
+		return err
+	}
+
+	secret, err := user.EnrollTOTP(handlerData.Db)
+	if err != nil {
+		return err
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", TOTPEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: models.TOTPProvisioningURI(handlerData.Config.Server.TOTPIssuer, user.Username, secret),
+	})
+
+	return nil
+}
+
+// TOTPConfirmHandler enables an enrolled TOTP secret
+// and returns new recovery codes
+func TOTPConfirmHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request LoginRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	if len(request.OTP) == 0 {
+		return RErrMissing.Prepend("Code")
+	}
+
+	// Don't verify the otp here since
+	// it belongs to the pending secret
+	otp := request.OTP
+	request.OTP = ""
+
+	user, err := authenticateCredentials(handlerData, w, r, request, true)
+	if err != nil {
+		return err
+	}
+
+	codes, err := user.ConfirmTOTP(handlerData.Db, otp)
+	switch err {
+	case nil:
+	case models.ErrorNoTOTPEnrollment:
+		return NewRequestError(err.Error(), http.StatusConflict)
+	default:
+		return handleLoginError(handlerData, GetClientIP(handlerData.Config, r), request.Username, err)
+	}
+
+	handlerData.Log.Infof("User '%s' enabled two-factor authentication", user.Username)
+	auditAs(handlerData, r, user, models.UserAuditEntry(models.AuditTOTPEnable, user))
+
+	sendResponse(w, libdm.ResponseSuccess, "", TOTPConfirmResponse{
+		RecoveryCodes: codes,
+	})
+	return nil
+}
+
+// TOTPDisableHandler disables TOTP for a user
+func TOTPDisableHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request LoginRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	user, err := authenticateCredentials(handlerData, w, r, request)
+	if err != nil {
+		return err
+	}
+
+	if user.RequiresTOTP() {
+		return RErrNotAllowed.Append("to disable two-factor authentication for your role")
+	}
+
+	if err = user.DisableTOTP(handlerData.Db); err != nil {
+		return err
+	}
+
+	handlerData.Log.Infof("User '%s' disabled two-factor authentication", user.Username)
+	auditAs(handlerData, r, user, models.UserAuditEntry(models.AuditTOTPDisable, user))
+
+	sendResponse(w, libdm.ResponseSuccess, "", nil)
+	return nil
+}
+
+// Verify the credentials of request and return the user. The
+// second factor is verified unless skipSecondFactor is set
+func authenticateCredentials(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request, request LoginRequest, skipSecondFactor ...bool) (*models.User, error) {
+	if len(request.Password) == 0 || len(request.Username) == 0 {
+		return nil, RErrMissing.Prepend("Input")
+	}
+
+	// Reject locked out clients and users
+	ip := GetClientIP(handlerData.Config, r)
+	if err := checkLockout(handlerData, w, models.LockoutSubjectIP(ip), models.LockoutSubjectUser(request.Username)); err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		Username: request.Username,
+		Password: request.Password,
+	}
+
+	err := user.Authenticate(handlerData.Db, handlerData.Config)
+	if err == nil && user.HasTOTP() && len(skipSecondFactor) == 0 {
+		err = user.VerifySecondFactor(handlerData.Db, request.OTP)
+	}
+
+	if err != nil {
+		return nil, handleLoginError(handlerData, ip, request.Username, err)
+	}
+
+	resetFailedAttempts(handlerData, request.Username)
+	return &user, nil
+}
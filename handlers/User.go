@@ -6,13 +6,23 @@ import (
 	"github.com/DataManager-Go/DataManagerServer/handlers/web"
 	"github.com/DataManager-Go/DataManagerServer/models"
 	libdm "github.com/DataManager-Go/libdatamanager"
-
-	"github.com/JojiiOfficial/gaw"
 )
 
+// LoginRequest credentials with an optional second factor
+type LoginRequest struct {
+	libdm.CredentialsRequest
+	OTP string `json:"otp,omitempty"`
+}
+
+// RegisterRequest credentials with an optional invite code
+type RegisterRequest struct {
+	libdm.CredentialsRequest
+	Invite string `json:"invite,omitempty"`
+}
+
 // Login login handler
 func Login(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
-	var request libdm.CredentialsRequest
+	var request LoginRequest
 
 	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
 		return nil
@@ -22,16 +32,30 @@ func Login(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request)
 		return RErrMissing.Prepend("Input")
 	}
 
+	// Reject locked out clients and users
+	ip := GetClientIP(handlerData.Config, r)
+	if err := checkLockout(handlerData, w, models.LockoutSubjectIP(ip), models.LockoutSubjectUser(request.Username)); err != nil {
+		return err
+	}
+
 	user := models.User{
 		Username: request.Username,
-		Password: gaw.SHA512(request.Username + request.Password),
+		Password: request.Password,
 	}
 
-	session, err := user.Login(handlerData.Db, request.MachineID)
+	session, err := user.Login(handlerData.Db, handlerData.Config, request.MachineID, request.OTP, ip)
 	if err != nil {
-		return RErrInvalid.Append("credentials")
+		// user is loaded if it exists
+		entry := models.UserAuditEntry(models.AuditLoginFailed, &user)
+		entry.Target = request.Username
+		audit(handlerData, r, entry)
+
+		return handleLoginError(handlerData, ip, request.Username, err)
 	}
 
+	resetFailedAttempts(handlerData, request.Username)
+	auditAs(handlerData, r, &user, models.UserAuditEntry(models.AuditLogin, &user))
+
 	if session != nil {
 		sendResponse(w, libdm.ResponseSuccess, "", libdm.LoginResponse{
 			Token:     session.Token,
@@ -44,34 +68,62 @@ func Login(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
-// Register register handler
+// Register register handler. Registering with an
+// invite code works even if registration is disabled
 func Register(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
-	if !handlerData.Config.Server.AllowRegistration {
-		return RErrRegistrationNotAccepted
-	}
-
-	var request libdm.CredentialsRequest
+	var request RegisterRequest
 
 	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
 		return nil
 	}
 
+	if !handlerData.Config.Server.AllowRegistration && len(request.Invite) == 0 {
+		return RErrRegistrationNotAccepted
+	}
+
 	if len(request.Password) == 0 || len(request.Username) == 0 {
 		return RErrMissing.Prepend("Input")
 	}
 
+	// Reject locked out clients
+	ip := GetClientIP(handlerData.Config, r)
+	if err := checkLockout(handlerData, w, models.LockoutSubjectIP(ip)); err != nil {
+		return err
+	}
+
 	user := models.User{
 		Username: request.Username,
 		Password: request.Password,
 	}
 
-	err := user.Register(handlerData.Db, handlerData.Config)
-	if err == models.ErrorUserAlreadyExists {
+	var err error
+	if len(request.Invite) > 0 {
+		err = user.RegisterWithInvite(handlerData.Db, handlerData.Config, request.Invite)
+	} else {
+		err = user.Register(handlerData.Db, handlerData.Config)
+	}
+
+	switch err {
+	case nil:
+	case models.ErrorUserAlreadyExists:
+		registerFailedAttempt(handlerData, ip, "")
 		return RErrAlreadyExists.Prepend("User")
-	} else if err != nil {
+	case models.ErrorInvalidInvite:
+		registerFailedAttempt(handlerData, ip, "")
+		return RErrInvalid.Prepend("Invite").WithCode(http.StatusForbidden)
+	default:
 		return err
 	}
 
+	if newUser, err := models.FindUser(handlerData.Db, request.Username); !handlerData.LogError(err) {
+		entry := models.UserAuditEntry(models.AuditRegister, newUser)
+		if len(request.Invite) > 0 {
+			entry = entry.WithChange(nil, newUser.Role.RoleName)
+		}
+
+		auditAs(handlerData, r, newUser, entry)
+	}
+
 	sendResponse(w, libdm.ResponseSuccess, "success", nil, http.StatusOK)
 
 	return nil
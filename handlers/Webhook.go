@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/handlers/web"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	libdm "github.com/DataManager-Go/libdatamanager"
+	"github.com/JojiiOfficial/gaw"
+	"github.com/gorilla/mux"
+)
+
+// Limits for delivery log queries
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+// WebhookRequest request to create, update or delete a webhook
+type WebhookRequest struct {
+	ID           uint     `json:"id,omitempty"`
+	Namespace    string   `json:"ns,omitempty"`
+	URL          string   `json:"url,omitempty"`
+	Events       []string `json:"events,omitempty"`
+	RotateSecret bool     `json:"rotateSecret,omitempty"`
+}
+
+// WebhookItem a webhook. The secret is only
+// returned on creation or if it was rotated
+type WebhookItem struct {
+	ID        uint                  `json:"id"`
+	Owner     string                `json:"owner,omitempty"`
+	Namespace string                `json:"ns"`
+	URL       string                `json:"url"`
+	Events    []models.WebhookEvent `json:"events"`
+	Created   time.Time             `json:"created"`
+	Secret    string                `json:"secret,omitempty"`
+}
+
+// WebhookListResponse response containing webhooks
+type WebhookListResponse struct {
+	Webhooks []WebhookItem `json:"webhooks"`
+}
+
+// WebhookDeliveriesRequest request for the delivery log of a webhook
+type WebhookDeliveriesRequest struct {
+	ID       uint `json:"id"`
+	BeforeID uint `json:"before,omitempty"`
+	Limit    int  `json:"limit,omitempty"`
+}
+
+// WebhookDeliveryItem a queued or sent delivery
+type WebhookDeliveryItem struct {
+	ID           uint                `json:"id"`
+	Time         time.Time           `json:"time"`
+	Event        models.WebhookEvent `json:"event"`
+	Status       string              `json:"status"`
+	Attempts     uint                `json:"attempts"`
+	LastAttempt  *time.Time          `json:"lastAttempt,omitempty"`
+	NextAttempt  *time.Time          `json:"nextAttempt,omitempty"`
+	ResponseCode int                 `json:"responseCode,omitempty"`
+	Error        string              `json:"error,omitempty"`
+	Payload      json.RawMessage     `json:"payload"`
+}
+
+// WebhookDeliveriesResponse response containing deliveries, newest first
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDeliveryItem `json:"deliveries"`
+}
+
+// Queue the webhooks for event of file. Errors
+// are only logged to not fail the triggering action
+func triggerWebhooks(handlerData web.HandlerData, event models.WebhookEvent, file *models.File) {
+	handlerData.LogError(models.TriggerWebhooks(handlerData.Db, handlerData.Config, event, file))
+}
+
+// WebhookHandler handler for webhook actions (create/update/delete)
+func WebhookHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	action := mux.Vars(r)["action"]
+	if !gaw.IsInStringArray(action, []string{"create", "update", "delete"}) {
+		return RErrBadRequest
+	}
+
+	if !handlerData.Config.Server.Webhooks.Enabled {
+		return RErrNotSupported.Prepend("Webhooks are")
+	}
+
+	var request WebhookRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	if action == "create" {
+		return createWebhook(handlerData, w, request)
+	}
+
+	webhook, err := findOwnWebhook(handlerData, request.ID)
+	if err != nil {
+		return err
+	}
+
+	if action == "delete" {
+		if err = webhook.Delete(handlerData.Db); err != nil {
+			return err
+		}
+
+		sendResponse(w, libdm.ResponseSuccess, "", nil)
+		return nil
+	}
+
+	// Update only the given values
+	if len(request.URL) > 0 {
+		if !isValidWebhookURL(request.URL, handlerData.Config) {
+			return RErrInvalid.Prepend("URL")
+		}
+
+		webhook.URL = request.URL
+	}
+
+	if len(request.Events) > 0 {
+		events, err := models.ParseWebhookEvents(request.Events)
+		if err != nil {
+			return RErrInvalid.Prepend("Event")
+		}
+
+		webhook.SetEvents(events)
+	}
+
+	if request.RotateSecret {
+		if err = webhook.RotateSecret(); err != nil {
+			return err
+		}
+	}
+
+	if err = webhook.Save(handlerData.Db); err != nil {
+		return err
+	}
+
+	item := webhookItem(webhook)
+	if request.RotateSecret {
+		item.Secret = webhook.Secret
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", item)
+	return nil
+}
+
+// Create a new webhook
+func createWebhook(handlerData web.HandlerData, w http.ResponseWriter, request WebhookRequest) error {
+	if len(request.Namespace) == 0 {
+		return RErrMissing.Prepend("Namespace")
+	}
+
+	if !isValidWebhookURL(request.URL, handlerData.Config) {
+		return RErrInvalid.Prepend("URL")
+	}
+
+	events, err := models.ParseWebhookEvents(request.Events)
+	if err != nil {
+		return RErrInvalid.Prepend("Event")
+	}
+
+	namespace := models.FindNamespace(handlerData.Db, request.Namespace, handlerData.User)
+	if !handleNamespaceErorrs(namespace, handlerData.User, true, w) {
+		return nil
+	}
+
+	webhook, err := models.CreateWebhook(handlerData.Db, handlerData.User, namespace, request.URL, events)
+	if err != nil {
+		return err
+	}
+
+	item := webhookItem(webhook)
+	item.Secret = webhook.Secret
+
+	sendResponse(w, libdm.ResponseSuccess, "", item)
+	return nil
+}
+
+// WebhookListHandler lists the webhooks of a user. Admins get all webhooks
+func WebhookListHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	userID := handlerData.User.ID
+	if handlerData.User.IsAdmin() {
+		userID = 0
+	}
+
+	webhooks, err := models.GetWebhooks(handlerData.Db, userID)
+	if err != nil {
+		return err
+	}
+
+	response := WebhookListResponse{
+		Webhooks: make([]WebhookItem, len(webhooks)),
+	}
+
+	for i := range webhooks {
+		response.Webhooks[i] = webhookItem(&webhooks[i])
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", response)
+	return nil
+}
+
+// WebhookDeliveriesHandler lists the deliveries of a webhook
+func WebhookDeliveriesHandler(handlerData web.HandlerData, w http.ResponseWriter, r *http.Request) error {
+	var request WebhookDeliveriesRequest
+	if !readRequestLimited(w, r, &request, handlerData.Config.Webserver.MaxRequestBodyLength) {
+		return nil
+	}
+
+	webhook, err := findOwnWebhook(handlerData, request.ID)
+	if err != nil {
+		return err
+	}
+
+	if request.Limit <= 0 {
+		request.Limit = defaultDeliveryLimit
+	} else if request.Limit > maxDeliveryLimit {
+		request.Limit = maxDeliveryLimit
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(handlerData.Db, webhook.ID, request.BeforeID, request.Limit)
+	if err != nil {
+		return err
+	}
+
+	response := WebhookDeliveriesResponse{
+		Deliveries: make([]WebhookDeliveryItem, len(deliveries)),
+	}
+
+	for i, delivery := range deliveries {
+		item := WebhookDeliveryItem{
+			ID:           delivery.ID,
+			Time:         delivery.CreatedAt,
+			Event:        delivery.Event,
+			Status:       delivery.Status,
+			Attempts:     delivery.Attempts,
+			ResponseCode: delivery.ResponseCode,
+			Error:        delivery.Error,
+			Payload:      json.RawMessage(delivery.Payload),
+		}
+
+		if !delivery.LastAttempt.IsZero() {
+			item.LastAttempt = &deliveries[i].LastAttempt
+		}
+		if delivery.Status == models.DeliveryPending {
+			item.NextAttempt = &deliveries[i].NextAttempt
+		}
+
+		response.Deliveries[i] = item
+	}
+
+	sendResponse(w, libdm.ResponseSuccess, "", response)
+	return nil
+}
+
+// Find a webhook of the requesting user. Admins can access all webhooks
+func findOwnWebhook(handlerData web.HandlerData, id uint) (*models.Webhook, error) {
+	if id == 0 {
+		return nil, RErrMissing.Prepend("Webhook ID")
+	}
+
+	webhook, err := models.FindWebhook(handlerData.Db, id)
+	if err != nil {
+		if err == models.ErrorWebhookNotFound {
+			return nil, RErrNotFound.Prepend("Webhook")
+		}
+
+		return nil, err
+	}
+
+	if webhook.UserID != handlerData.User.ID && !handlerData.User.IsAdmin() {
+		return nil, RErrNotFound.Prepend("Webhook")
+	}
+
+	return webhook, nil
+}
+
+// Returns true if u is an absolute http(s) URL
+// which doesn't point to an internal address
+func isValidWebhookURL(u string, config *models.Config) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+
+	// Hostnames are checked when connecting
+	if ip := net.ParseIP(parsed.Hostname()); ip != nil && !config.IsWebhookTarget(ip) {
+		return false
+	}
+
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && len(parsed.Host) > 0
+}
+
+// Build the WebhookItem for a webhook
+func webhookItem(webhook *models.Webhook) WebhookItem {
+	item := WebhookItem{
+		ID:      webhook.ID,
+		URL:     webhook.URL,
+		Events:  webhook.GetEvents(),
+		Created: webhook.CreatedAt,
+	}
+
+	if webhook.User != nil {
+		item.Owner = webhook.User.Username
+	}
+
+	if webhook.Namespace != nil {
+		item.Namespace = webhook.Namespace.Name
+	}
+
+	return item
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -50,9 +51,73 @@ func LogError(err error, context ...map[string]interface{}) bool {
 	return true
 }
 
+// GetClientIP returns the IP address of the client. Forwarding
+// headers are only respected if the request was sent by a
+// trusted reverse proxy
+func GetClientIP(config *models.Config, r *http.Request) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	if !config.IsTrustedProxy(net.ParseIP(remoteIP)) {
+		return remoteIP
+	}
+
+	// Walk the proxy chain backwards and
+	// use the first untrusted address
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		ips := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(ips[i]))
+			if ip == nil {
+				break
+			}
+
+			if i == 0 || !config.IsTrustedProxy(ip) {
+				return ip.String()
+			}
+		}
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP.String()
+	}
+
+	return remoteIP
+}
+
+// Returns the username set by an authentication
+// proxy. Empty if the request isn't from one
+func getProxyUsername(config *models.Config, r *http.Request) string {
+	if !config.Server.ProxyAuth.Enabled {
+		return ""
+	}
+
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	if !config.IsAuthProxy(net.ParseIP(remoteIP)) {
+		return ""
+	}
+
+	return strings.TrimSpace(r.Header.Get(config.Server.ProxyAuth.Header))
+}
+
 // AllowedSchemes schemes that are allowed in urls
 var AllowedSchemes = []string{"http", "https"}
 
+// Return an error if the users role doesn't grant permission
+func checkPermission(user *models.User, permission models.Permission, action string) error {
+	if !user.HasPermission(permission) {
+		return RErrNotAllowed.Append("to " + action)
+	}
+
+	return nil
+}
+
 func isValidHTTPURL(inp string) bool {
 	//check for valid URL
 	u, err := url.Parse(inp)
@@ -41,7 +41,7 @@ func PrevievFileHandler(handlerData HandlerData, w http.ResponseWriter, r *http.
 	}
 
 	//Send error
-	if LogError(err) {
+	if handlerData.LogError(err) {
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return nil
 	}
@@ -79,7 +79,7 @@ func PrevievFileHandler(handlerData HandlerData, w http.ResponseWriter, r *http.
 	}
 
 	//Serve preview
-	LogError(servePreviewTemplate(handlerData.Config, w, templateData))
+	handlerData.LogError(servePreviewTemplate(handlerData.Config, w, templateData))
 	return nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/DataManager-Go/DataManagerServer/metrics"
 	"github.com/DataManager-Go/DataManagerServer/models"
 	"github.com/gorilla/mux"
 	"github.com/h2non/filetype"
@@ -26,7 +27,7 @@ func RawFileHandler(handlerData HandlerData, w http.ResponseWriter, r *http.Requ
 	w.Header().Set("Content-Length", strconv.FormatInt(file.FileSize, 10))
 
 	// Send error
-	if LogError(err) {
+	if handlerData.LogError(err) {
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return nil
 	}
@@ -45,7 +46,7 @@ func RawFileHandler(handlerData HandlerData, w http.ResponseWriter, r *http.Requ
 	// Open file
 	f, err := os.Open(handlerData.Config.GetStorageFile(file.LocalName))
 	defer f.Close()
-	if LogError(err) {
+	if handlerData.LogError(err) {
 		if os.IsNotExist(err) {
 			NotFoundHandler(handlerData, w, r)
 			return nil
@@ -55,7 +56,7 @@ func RawFileHandler(handlerData HandlerData, w http.ResponseWriter, r *http.Requ
 		return nil
 	}
 
-	serveFileStream(handlerData.Config, f, w)
+	serveFileStream(handlerData.Config, metrics.CountReader(f, metrics.DownloadedBytes), w)
 
 	return nil
 }
@@ -16,9 +16,22 @@ import (
 
 //HandlerData handlerData for web
 type HandlerData struct {
-	Config *models.Config
-	Db     *gorm.DB
-	User   *models.User
+	Config  *models.Config
+	Db      *gorm.DB
+	User    *models.User
+	Session *models.LoginSession // Empty if authenticated by a proxy or certificate
+	Log     *log.Entry           // Logger of the request including its ID
+}
+
+//LogError logs err with the request ID. Returns true on error
+func (handlerData HandlerData) LogError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	handlerData.Log.Error(err.Error())
+
+	return true
 }
 
 //LogError returns true on error
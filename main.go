@@ -41,8 +41,50 @@ var (
 	configCmd           = app.Command("config", "Commands for the config file")
 	configCmdCreate     = configCmd.Command("create", "Create config file")
 	configCmdCreateName = configCmdCreate.Arg("name", "Config filename").Default(models.GetDefaultConfig()).String()
+	configCmdPrint      = configCmd.Command("print", "Print the effective config including env overrides. Secrets are masked")
 
 	syncFilesCmd = app.Command("sync-files", "Delete untracked files from the database and the filesystem")
+
+	// User commands
+	userCmd               = app.Command("user", "Commands for managing users")
+	userCmdCreate         = userCmd.Command("create", "Create a user")
+	userCmdCreateName     = userCmdCreate.Arg("username", "The name of the new user").Required().String()
+	userCmdCreateRole     = userCmdCreate.Flag("role", "The ID of the users role. Uses the default role if not set").Uint()
+	userCmdCreatePassword = userCmdCreate.Flag("password", "The password of the user. Prompts if not set").Envar(getEnVar(EnVarPassword)).String()
+	userCmdRole           = userCmd.Command("role", "Set the role of a user")
+	userCmdRoleName       = userCmdRole.Arg("username", "The user").Required().String()
+	userCmdRoleID         = userCmdRole.Arg("role", "The ID of the new role").Required().Uint()
+	userCmdPasswd         = userCmd.Command("passwd", "Reset the password of a user and revoke its sessions")
+	userCmdPasswdName     = userCmdPasswd.Arg("username", "The user").Required().String()
+	userCmdPasswdPassword = userCmdPasswd.Flag("password", "The new password. Prompts if not set").Envar(getEnVar(EnVarPassword)).String()
+	userCmdList           = userCmd.Command("list", "List all users")
+	userCmdLogout         = userCmd.Command("logout", "Revoke all sessions of a user")
+	userCmdLogoutName     = userCmdLogout.Arg("username", "The user").Required().String()
+	userCmdExport         = userCmd.Command("export", "Export all files and data of a user into a zip archive")
+	userCmdExportName     = userCmdExport.Arg("username", "The user").Required().String()
+	userCmdExportOutput   = userCmdExport.Flag("output", "The archive to create. Defaults to <username>_export.zip").Short('o').String()
+
+	// Role commands
+	roleCmd           = app.Command("role", "Commands for managing roles")
+	roleCmdList       = roleCmd.Command("list", "List all roles")
+	roleCmdCreate     = roleCmd.Command("create", "Create a role")
+	roleCmdCreateName = roleCmdCreate.Arg("name", "The name of the new role").Required().String()
+	roleCmdCreateArgs = newRoleFlags(roleCmdCreate)
+	roleCmdEdit       = roleCmd.Command("edit", "Edit a role. Only the given values are changed")
+	roleCmdEditID     = roleCmdEdit.Arg("id", "The ID of the role").Required().Uint()
+	roleCmdEditName   = roleCmdEdit.Flag("name", "The new name of the role").String()
+	roleCmdEditArgs   = newRoleFlags(roleCmdEdit)
+	roleCmdDelete     = roleCmd.Command("delete", "Delete a role which isn't assigned to any user")
+	roleCmdDeleteID   = roleCmdDelete.Arg("id", "The ID of the role").Required().Uint()
+
+	// Namespace commands
+	namespaceCmd         = app.Command("namespace", "Commands for namespaces")
+	namespaceCmdList     = namespaceCmd.Command("list", "List all namespaces")
+	namespaceCmdListUser = namespaceCmdList.Flag("user", "Only list namespaces of this user").Short('u').String()
+
+	// Storage commands
+	storageCmd      = app.Command("storage", "Commands for the file storage")
+	storageCmdUsage = storageCmd.Command("usage", "Show the storage usage per user")
 )
 
 var (
@@ -58,6 +100,7 @@ const (
 	EnVarLogLevel   = "LOG_LEVEL"
 	EnVarNoColor    = "NO_COLOR"
 	EnVarConfigFile = "CONFIG"
+	EnVarPassword   = "PASSWORD"
 )
 
 // Return the variable using the server prefix
@@ -104,11 +147,20 @@ func main() {
 			return
 		}
 
+		// Print the config even if it's invalid
+		if parsed == configCmdPrint.FullCommand() {
+			LogError(printConfig())
+			return
+		}
+
 		if !config.Check() {
 			log.Info("Exiting")
 			return
 		}
 
+		config.ApplyLogLevel()
+		models.SetLiveConfig(config)
+
 		log.Debug("Connecting to db")
 
 		var err error
@@ -147,6 +199,62 @@ func main() {
 			}
 		}
 
+	// Users
+	case userCmdCreate.FullCommand():
+		{
+			LogError(createUser(*userCmdCreateName, *userCmdCreatePassword, *userCmdCreateRole))
+		}
+	case userCmdRole.FullCommand():
+		{
+			LogError(setUserRole(*userCmdRoleName, *userCmdRoleID))
+		}
+	case userCmdPasswd.FullCommand():
+		{
+			LogError(resetUserPassword(*userCmdPasswdName, *userCmdPasswdPassword))
+		}
+	case userCmdList.FullCommand():
+		{
+			LogError(listUsers())
+		}
+	case userCmdLogout.FullCommand():
+		{
+			LogError(logoutUser(*userCmdLogoutName))
+		}
+	case userCmdExport.FullCommand():
+		{
+			LogError(exportUser(*userCmdExportName, *userCmdExportOutput))
+		}
+
+	// Roles
+	case roleCmdList.FullCommand():
+		{
+			LogError(listRoles())
+		}
+	case roleCmdCreate.FullCommand():
+		{
+			LogError(createRole(*roleCmdCreateName, roleCmdCreateArgs))
+		}
+	case roleCmdEdit.FullCommand():
+		{
+			LogError(editRole(*roleCmdEditID, *roleCmdEditName, roleCmdEditArgs))
+		}
+	case roleCmdDelete.FullCommand():
+		{
+			LogError(deleteRole(*roleCmdDeleteID))
+		}
+
+	// Namespaces
+	case namespaceCmdList.FullCommand():
+		{
+			LogError(listNamespaces(*namespaceCmdListUser))
+		}
+
+	// Storage
+	case storageCmdUsage.FullCommand():
+		{
+			LogError(showStorageUsage())
+		}
+
 	// Config --------------------
 	case configCmdCreate.FullCommand():
 		{
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prefix of all metrics
+const namespace = "datamanager"
+
+var (
+	// Requests handled requests by route name and status code
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Handled HTTP requests by route and status code.",
+	}, []string{"route", "code"})
+
+	// RequestDuration duration of handled requests by route name and status code
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "code"})
+
+	// UploadedBytes bytes of uploaded files
+	UploadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploaded_bytes_total",
+		Help:      "Bytes of successfully uploaded files.",
+	})
+
+	// DownloadedBytes bytes sent of downloaded files
+	DownloadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Bytes sent of downloaded files including public files.",
+	})
+
+	// ActiveUploads uploads currently in progress
+	ActiveUploads = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_uploads",
+		Help:      "Uploads currently in progress.",
+	})
+
+	// SessionCacheLookups session cache lookups by result (hit or miss)
+	SessionCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "session_cache_lookups_total",
+		Help:      "Session cache lookups by result.",
+	}, []string{"result"})
+
+	// CleanupRuns runs of the cleanup service
+	CleanupRuns = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_runs_total",
+		Help:      "Runs of the cleanup service.",
+	})
+
+	// CleanupDeleted rows deleted by the cleanup service by kind
+	CleanupDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_deleted_total",
+		Help:      "Rows deleted by the cleanup service by kind.",
+	}, []string{"kind"})
+
+	// CleanupErrors failed cleanup jobs by kind
+	CleanupErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_errors_total",
+		Help:      "Failed cleanup jobs by kind.",
+	}, []string{"kind"})
+
+	// CleanupLastRun time of the last cleanup run
+	CleanupLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cleanup_last_run_timestamp_seconds",
+		Help:      "Unix time of the last run of the cleanup service.",
+	})
+
+	// ShredJobs finished shred jobs by result (success or error)
+	ShredJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shred_jobs_total",
+		Help:      "Finished shred jobs by result.",
+	}, []string{"result"})
+
+	// ShredBytes bytes of shredded files
+	ShredBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "shred_bytes_total",
+		Help:      "Bytes of shredded files.",
+	})
+
+	// ActiveShredJobs shred jobs currently running
+	ActiveShredJobs = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_shred_jobs",
+		Help:      "Shred jobs currently running.",
+	})
+
+	// ShredDuration duration of shred jobs
+	ShredDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "shred_duration_seconds",
+		Help:      "Duration of shred jobs.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+	})
+)
+
+// NewDesc returns the description of a metric with the common prefix
+func NewDesc(name, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+}
+
+// CountReader returns a reader adding the bytes read from reader to counter
+func CountReader(reader io.Reader, counter prometheus.Counter) io.Reader {
+	return &countReader{
+		reader:  reader,
+		counter: counter,
+	}
+}
+
+type countReader struct {
+	reader  io.Reader
+	counter prometheus.Counter
+}
+
+func (cr *countReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.counter.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// AuditAction an action recorded in the audit log
+type AuditAction string
+
+// Audited actions
+const (
+	AuditLogin        AuditAction = "user.login"
+	AuditLoginFailed  AuditAction = "user.loginFailed"
+	AuditLogout       AuditAction = "user.logout"
+	AuditRegister     AuditAction = "user.register"
+	AuditPassword     AuditAction = "user.password"
+	AuditRename       AuditAction = "user.rename"
+	AuditDeleteUser   AuditAction = "user.delete"
+	AuditTOTPEnable   AuditAction = "user.totpEnable"
+	AuditTOTPDisable  AuditAction = "user.totpDisable"
+	AuditFileUpload   AuditAction = "file.upload"
+	AuditFileReplace  AuditAction = "file.replace"
+	AuditFileDownload AuditAction = "file.download"
+	AuditFileRename   AuditAction = "file.rename"
+	AuditFileMove     AuditAction = "file.move"
+	AuditFileTags     AuditAction = "file.tags"
+	AuditFileGroups   AuditAction = "file.groups"
+	AuditFilePublish  AuditAction = "file.publish"
+	AuditFilePrivate  AuditAction = "file.unpublish"
+	AuditFileDelete   AuditAction = "file.delete"
+	AuditNSCreate     AuditAction = "namespace.create"
+	AuditNSRename     AuditAction = "namespace.rename"
+	AuditNSDelete     AuditAction = "namespace.delete"
+	AuditAttrCreate   AuditAction = "attribute.create"
+	AuditAttrRename   AuditAction = "attribute.rename"
+	AuditAttrDelete   AuditAction = "attribute.delete"
+	AuditInvite       AuditAction = "invite.create"
+	AuditInviteRevoke AuditAction = "invite.revoke"
+	AuditAdminUser    AuditAction = "admin.user"
+	AuditAdminRole    AuditAction = "admin.role"
+	AuditAdminLockout AuditAction = "admin.lockout"
+	AuditAdminConfig  AuditAction = "admin.config"
+)
+
+// Audit target types
+const (
+	AuditTargetUser      = "user"
+	AuditTargetFile      = "file"
+	AuditTargetNamespace = "namespace"
+	AuditTargetTag       = "tag"
+	AuditTargetGroup     = "group"
+	AuditTargetRole      = "role"
+	AuditTargetInvite    = "invite"
+	AuditTargetLockout   = "lockout"
+	AuditTargetConfig    = "config"
+)
+
+// AuditEntry an entry in the append-only audit log. Before
+// and After contain JSON encoded values of changed properties
+type AuditEntry struct {
+	ID          uint      `gorm:"primarykey"`
+	CreatedAt   time.Time `gorm:"index"`
+	ActorID     uint      `gorm:"index"`
+	Actor       string
+	IP          string
+	Action      AuditAction `gorm:"index"`
+	NamespaceID uint        `gorm:"index"`
+	TargetType  string
+	TargetID    uint
+	Target      string
+	Before      string
+	After       string
+}
+
+// AuditFilter filter for querying the audit log
+type AuditFilter struct {
+	// Only return entries of these namespaces or
+	// targeting UserID. Ignored if nil
+	NamespaceIDs []uint
+	UserID       uint
+
+	ActorID     uint
+	NamespaceID uint
+	Action      AuditAction
+	TargetType  string
+	TargetID    uint
+	Since       time.Time
+	Until       time.Time
+	BeforeID    uint
+	Limit       int
+}
+
+// FileAuditEntry returns an entry for an action on file
+func FileAuditEntry(action AuditAction, file *File) AuditEntry {
+	return AuditEntry{
+		Action:      action,
+		NamespaceID: file.NamespaceID,
+		TargetType:  AuditTargetFile,
+		TargetID:    file.ID,
+		Target:      file.Name,
+	}
+}
+
+// UserAuditEntry returns an entry for an action on user
+func UserAuditEntry(action AuditAction, user *User) AuditEntry {
+	return AuditEntry{
+		Action:     action,
+		TargetType: AuditTargetUser,
+		TargetID:   user.ID,
+		Target:     user.Username,
+	}
+}
+
+// Sub returns a more specific action
+func (action AuditAction) Sub(name string) AuditAction {
+	return action + AuditAction("."+name)
+}
+
+// WithChange sets the values before and after the action
+func (entry AuditEntry) WithChange(before, after interface{}) AuditEntry {
+	entry.Before = auditValue(before)
+	entry.After = auditValue(after)
+	return entry
+}
+
+// Encode an audited value. nil values are stored empty
+func auditValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		log.Error(err)
+		return ""
+	}
+
+	// Typed nil values
+	if string(b) == "null" {
+		return ""
+	}
+
+	return string(b)
+}
+
+// Create appends the entry to the audit log
+func (entry *AuditEntry) Create(db *gorm.DB) error {
+	entry.ID = 0
+	return db.Create(entry).Error
+}
+
+// GetAuditEntries returns the newest entries matching filter
+func GetAuditEntries(db *gorm.DB, filter AuditFilter) ([]AuditEntry, error) {
+	query := db.Order("id DESC").Limit(filter.Limit)
+
+	if filter.NamespaceIDs != nil {
+		query = query.Where("(namespace_id IN (?) OR (target_type = ? AND target_id = ?))", filter.NamespaceIDs, AuditTargetUser, filter.UserID)
+	}
+	if filter.ActorID > 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.NamespaceID > 0 {
+		query = query.Where("namespace_id = ?", filter.NamespaceID)
+	}
+	if len(filter.Action) > 0 {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if len(filter.TargetType) > 0 {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID > 0 {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+
+	var entries []AuditEntry
+	return entries, query.Find(&entries).Error
+}
+
+// DeleteOldAuditEntries deletes entries older than the configured
+// retention. Entries are kept forever if no retention is set
+func DeleteOldAuditEntries(db *gorm.DB, config *Config) (int64, error) {
+	if config.Server.AuditRetention <= 0 {
+		return 0, nil
+	}
+
+	res := db.Where("created_at < ?", time.Now().Add(-config.Server.AuditRetention)).Delete(&AuditEntry{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ChangeKind the kind of a changed object
+type ChangeKind string
+
+// Changed objects
+const (
+	ChangeFile      ChangeKind = "file"
+	ChangeTag       ChangeKind = "tag"
+	ChangeGroup     ChangeKind = "group"
+	ChangeNamespace ChangeKind = "namespace"
+)
+
+// ChangeOp the operation applied to an object
+type ChangeOp string
+
+// Change operations
+const (
+	ChangeCreated ChangeOp = "created"
+	ChangeUpdated ChangeOp = "updated"
+	ChangeDeleted ChangeOp = "deleted"
+)
+
+// Change an entry of the change log. IDs are increasing
+// and used as cursor. Changes belong to the owner of
+// the namespace the changed object is in
+type Change struct {
+	ID          uint      `gorm:"primarykey"`
+	CreatedAt   time.Time `gorm:"index"`
+	UserID      uint      `gorm:"index"`
+	NamespaceID uint
+	Kind        ChangeKind
+	Op          ChangeOp
+	TargetID    uint
+	Name        string
+}
+
+// Key of the advisory lock serializing changes
+const changeLogLock = 0x646d6368
+
+// Wakes up clients waiting for changes of a user
+var changeWaiters = struct {
+	sync.Mutex
+	channels map[uint]chan struct{}
+}{
+	channels: make(map[uint]chan struct{}),
+}
+
+// ChangeLog records changes in the transaction applying them
+type ChangeLog struct {
+	tx     *gorm.DB
+	locked bool
+	users  []uint
+}
+
+// WithChanges runs fn in a transaction. Changes recorded with the passed
+// ChangeLog are committed along with the changes fn applies to tx, so they
+// can't be lost or seen before being applied. Waiting clients are notified
+// after the commit
+func WithChanges(db *gorm.DB, fn func(tx *gorm.DB, changes *ChangeLog) error) error {
+	changes := ChangeLog{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		changes.tx = tx
+		return fn(tx, &changes)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range changes.users {
+		notifyChange(userID)
+	}
+
+	return nil
+}
+
+// Record appends a change of an object in namespaceID to the change log
+func (changes *ChangeLog) Record(namespaceID uint, kind ChangeKind, op ChangeOp, targetID uint, name string) error {
+	if err := changes.lock(); err != nil {
+		return err
+	}
+
+	// Changes belong to the namespace owner
+	var namespace Namespace
+	if err := changes.tx.Unscoped().Select("id", "creator").First(&namespace, namespaceID).Error; err != nil {
+		return err
+	}
+
+	err := changes.tx.Create(&Change{
+		UserID:      namespace.UserID,
+		NamespaceID: namespaceID,
+		Kind:        kind,
+		Op:          op,
+		TargetID:    targetID,
+		Name:        name,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	changes.users = append(changes.users, namespace.UserID)
+	return nil
+}
+
+// Postgres takes IDs from a sequence before committing. A change committed
+// after one with a higher ID would be skipped by clients which already moved
+// their cursor past it. Transactions recording changes are serialized until
+// they're committed to commit IDs in order. SQLite only has a single writer
+func (changes *ChangeLog) lock() error {
+	if changes.locked || changes.tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	if err := changes.tx.Exec("SELECT pg_advisory_xact_lock(?)", changeLogLock).Error; err != nil {
+		return err
+	}
+
+	changes.locked = true
+	return nil
+}
+
+// ChangeNotification returns a channel which is
+// closed on the next change recorded for userID
+func ChangeNotification(userID uint) <-chan struct{} {
+	changeWaiters.Lock()
+	defer changeWaiters.Unlock()
+
+	channel, ok := changeWaiters.channels[userID]
+	if !ok {
+		channel = make(chan struct{})
+		changeWaiters.channels[userID] = channel
+	}
+
+	return channel
+}
+
+// Wake up all waiters of userID
+func notifyChange(userID uint) {
+	changeWaiters.Lock()
+	defer changeWaiters.Unlock()
+
+	if channel, ok := changeWaiters.channels[userID]; ok {
+		close(channel)
+		delete(changeWaiters.channels, userID)
+	}
+}
+
+// GetChanges returns at most limit changes of userID after cursor, oldest first
+func GetChanges(db *gorm.DB, userID, cursor uint, limit int) ([]Change, error) {
+	var changes []Change
+	err := db.Where("user_id = ? AND id > ?", userID, cursor).
+		Order("id").
+		Limit(limit).
+		Find(&changes).Error
+
+	return changes, err
+}
+
+// GetChangeCursor returns the ID of the latest change
+func GetChangeCursor(db *gorm.DB) (uint, error) {
+	var change Change
+	err := db.Select("id").Order("id DESC").Limit(1).Find(&change).Error
+	return change.ID, err
+}
+
+// IsChangeCursorExpired returns true if changes after cursor were deleted already
+func IsChangeCursorExpired(db *gorm.DB, cursor uint) (bool, error) {
+	var change Change
+	if err := db.Select("id").Order("id").Limit(1).Find(&change).Error; err != nil {
+		return false, err
+	}
+
+	return change.ID > cursor+1, nil
+}
+
+// DeleteOldChanges deletes changes older than the configured retention. The
+// newest of them is kept to be able to tell which cursors expired. Changes
+// are kept forever if no retention is set
+func DeleteOldChanges(db *gorm.DB, config *Config) (int64, error) {
+	if config.Server.ChangeRetention <= 0 {
+		return 0, nil
+	}
+
+	var newest Change
+	err := db.Select("id").
+		Where("created_at < ?", time.Now().Add(-config.Server.ChangeRetention)).
+		Order("id DESC").
+		Limit(1).
+		Find(&newest).Error
+	if err != nil || newest.ID == 0 {
+		return 0, err
+	}
+
+	res := db.Where("id < ?", newest.ID).Delete(&Change{})
+	return res.RowsAffected, res.Error
+}
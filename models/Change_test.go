@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestWithChanges(t *testing.T) {
+	db := newTestDB(t, &Config{})
+
+	namespace := Namespace{Name: "alice_default", UserID: 1}
+	if err := db.Create(&namespace).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	notification := ChangeNotification(1)
+
+	// Changes of failed transactions aren't recorded
+	errFailed := errors.New("failed")
+	err := WithChanges(db, func(tx *gorm.DB, changes *ChangeLog) error {
+		if err := changes.Record(namespace.ID, ChangeFile, ChangeCreated, 1, "file"); err != nil {
+			return err
+		}
+
+		return errFailed
+	})
+	if err != errFailed {
+		t.Fatalf("failed transaction returned %v", err)
+	}
+
+	select {
+	case <-notification:
+		t.Fatal("notified about a rolled back change")
+	default:
+	}
+
+	if changes, err := GetChanges(db, 1, 0, 10); err != nil || len(changes) != 0 {
+		t.Fatalf("rolled back changes recorded: %v, %v", changes, err)
+	}
+
+	// Committed changes are recorded in order
+	err = WithChanges(db, func(tx *gorm.DB, changes *ChangeLog) error {
+		if err := changes.Record(namespace.ID, ChangeFile, ChangeDeleted, 1, "file"); err != nil {
+			return err
+		}
+
+		return changes.Record(namespace.ID, ChangeFile, ChangeCreated, 1, "file")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-notification:
+	default:
+		t.Error("not notified about committed changes")
+	}
+
+	changes, err := GetChanges(db, 1, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 2 || changes[0].Op != ChangeDeleted || changes[1].Op != ChangeCreated || changes[0].ID >= changes[1].ID {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+}
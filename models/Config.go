@@ -1,6 +1,9 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
@@ -14,36 +17,163 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Private and reserved networks not reachable from the internet
+var internalNetworks = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"fc00::/7",
+}
+
 // Config config for the server
 type Config struct {
 	Server    configServer
 	Webserver webserverConf
+
+	// File the config was loaded from
+	file string
 }
 
 type webserverConf struct {
-	Profiling            bool
-	MaxHeaderLength      uint  `default:"8000" required:"true"`
-	MaxRequestBodyLength int64 `default:"10000" required:"true"`
-	MaxUploadFileLength  int64 `default:"1000000000" required:"true"`
-	DownloadFileBuffer   int   `default:"100000" required:"true"`
-	UserAgentsRawfile    []string
-	MaxPreviewFilesize   int64  `default:"50000"`
-	HTMLFiles            string `default:"./html/" required:"true"`
-	ReadTimeout          time.Duration
-	WriteTimeout         time.Duration
-	SchemeOverwrite      string
-	HTTP                 configHTTPstruct
-	HTTPS                configTLSStruct
-	AceTheme             string
+	Profiling              bool
+	MaxHeaderLength        uint  `default:"8000" required:"true"`
+	MaxRequestBodyLength   int64 `default:"10000" required:"true"`
+	MaxUploadFileLength    int64 `default:"1000000000" required:"true"`
+	DownloadFileBuffer     int   `default:"100000" required:"true"`
+	UserAgentsRawfile      []string
+	MaxPreviewFilesize     int64  `default:"50000"`
+	HTMLFiles              string `default:"./html/" required:"true"`
+	ReadTimeout            time.Duration
+	WriteTimeout           time.Duration
+	ShutdownTimeout        time.Duration `default:"20s"`
+	ShutdownReadinessDelay time.Duration
+	SchemeOverwrite        string
+	TrustedProxies         []string
+	HTTP                   configHTTPstruct
+	HTTPS                  configTLSStruct
+	AceTheme               string
+	Metrics                metricsConfig
+	AccessLogFile          string // Logs to stdout if empty
+}
+
+// Prometheus metrics endpoint. Served on the API listeners
+// if no ListenAddress is set. Requires Token as bearer if set
+type metricsConfig struct {
+	Enabled       bool
+	ListenAddress string
+	Token         string `secret:"true"`
 }
 
 type configServer struct {
+	LogLevel                  string // Overrides the log level flag if set
 	Database                  configDBstruct
 	PathConfig                pathConfig
 	Roles                     roleConfig
 	AllowRegistration         bool          `default:"false"`
 	DeleteUnusedSessionsAfter time.Duration `default:"10m"`
+	SessionIdleTimeout        time.Duration
+	SessionMaxLifetime        time.Duration
 	SearchInOtherNamespaces   bool
+	PasswordHashing           hashingConfig
+	LoginProtection           loginProtectionConfig
+	TOTPIssuer                string `default:"DataManager"`
+	LDAP                      ldapConfig
+	OIDC                      oidcConfig
+	ProxyAuth                 proxyAuthConfig
+	AuditRetention            time.Duration
+	ChangeRetention           time.Duration
+	Webhooks                  webhookConfig
+}
+
+// Notifications about file events
+type webhookConfig struct {
+	Enabled           bool
+	Timeout           time.Duration `default:"10s"`
+	MaxAttempts       uint          `default:"8"`
+	RetryDelay        time.Duration `default:"30s"`
+	MaxRetryDelay     time.Duration `default:"6h"`
+	DeliveryRetention time.Duration
+
+	// Internal networks webhooks can be delivered to
+	AllowedNetworks []string
+}
+
+// Authentication against an LDAP directory
+type ldapConfig struct {
+	Enabled            bool
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string
+	BindPassword       string `secret:"true"`
+	BaseDN             string
+	UserFilter         string `default:"(uid=%s)"`
+	GroupAttribute     string `default:"memberOf"`
+	GroupRoles         []ldapGroupRole
+	Timeout            time.Duration `default:"10s"`
+}
+
+// Role assigned to members of an LDAP group
+type ldapGroupRole struct {
+	Group string
+	Role  uint
+}
+
+// Login using an OpenID Connect provider
+type oidcConfig struct {
+	Enabled       bool
+	Issuer        string
+	ClientID      string
+	ClientSecret  string `secret:"true"`
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string `default:"preferred_username"`
+	RoleClaim     string `default:"groups"`
+	ClaimRoles    []oidcClaimRole
+
+	// Let users of roles requiring 2FA login
+	// relying on the providers second factor
+	TrustExternal2FA bool
+}
+
+// Role assigned to users having a value in their role claim
+type oidcClaimRole struct {
+	Value string
+	Role  uint
+}
+
+// Authentication by a reverse proxy passing the username in a header
+type proxyAuthConfig struct {
+	Enabled        bool
+	Header         string `default:"Remote-User"`
+	TrustedProxies []string
+	AutoCreate     bool
+
+	// Let users of roles requiring 2FA login
+	// relying on the proxies second factor
+	TrustExternal2FA bool
+}
+
+// Brute-force protection for login and registration
+type loginProtectionConfig struct {
+	Enabled            bool
+	MaxFailuresPerUser uint          `default:"5"`
+	MaxFailuresPerIP   uint          `default:"20"`
+	Lockout            time.Duration `default:"1m"`
+	MaxLockout         time.Duration `default:"1h"`
+	ResetAfter         time.Duration `default:"24h"`
+}
+
+// Argon2id parameters for password hashing
+type hashingConfig struct {
+	Memory      uint32 `default:"65536"`
+	Iterations  uint32 `default:"3"`
+	Parallelism uint8  `default:"2"`
+	SaltLength  uint32 `default:"16"`
+	KeyLength   uint32 `default:"32"`
 }
 
 type roleConfig struct {
@@ -53,6 +183,8 @@ type roleConfig struct {
 
 type pathConfig struct {
 	FileStore string `required:"true"`
+	// Free bytes required on the file store to be ready. 0 disables the check
+	MinFreeSpace uint64
 }
 
 type configDBstruct struct {
@@ -60,19 +192,28 @@ type configDBstruct struct {
 	Host         string
 	Username     string
 	Database     string
-	Pass         string
+	Pass         string `secret:"true"`
 	DatabasePort int
 	SSLMode      string
 }
 
 // Config for HTTPS
 type configTLSStruct struct {
-	Enabled       bool   `default:"false"`
-	ListenAddress string `default:":443"`
-	CertFile      string
-	KeyFile       string
+	Enabled            bool   `default:"false"`
+	ListenAddress      string `default:":443"`
+	CertFile           string
+	KeyFile            string
+	ClientCAFile       string
+	RequireClientCert  bool
+	ClientCertUsername string `default:"cn"`
+
+	// Let users of roles requiring 2FA login with a client certificate
+	TrustClientCert2FA bool
 }
 
+// ClientCertUsernameFields certificate fields which can be used as username
+var ClientCertUsernameFields = []string{"cn", "email", "dns", "uri"}
+
 // Config for HTTP
 type configHTTPstruct struct {
 	Enabled       bool   `default:"false"`
@@ -129,27 +270,49 @@ func InitConfig(confFile string, createMode bool) (*Config, bool) {
 				},
 				AllowRegistration:         false,
 				DeleteUnusedSessionsAfter: 10 * time.Minute,
+				SessionIdleTimeout:        30 * 24 * time.Hour,
+				SessionMaxLifetime:        90 * 24 * time.Hour,
 				SearchInOtherNamespaces:   true,
+				PasswordHashing: hashingConfig{
+					Memory:      64 * 1024,
+					Iterations:  3,
+					Parallelism: 2,
+					SaltLength:  16,
+					KeyLength:   32,
+				},
+				LoginProtection: loginProtectionConfig{
+					Enabled:            true,
+					MaxFailuresPerUser: 5,
+					MaxFailuresPerIP:   20,
+					Lockout:            time.Minute,
+					MaxLockout:         time.Hour,
+					ResetAfter:         24 * time.Hour,
+				},
+				TOTPIssuer: "DataManager",
+				Webhooks: webhookConfig{
+					Timeout:           10 * time.Second,
+					MaxAttempts:       8,
+					RetryDelay:        30 * time.Second,
+					MaxRetryDelay:     6 * time.Hour,
+					DeliveryRetention: 30 * 24 * time.Hour,
+				},
 				Roles: roleConfig{
 					DefaultRole: 1,
 					Roles: []Role{
 						{
-							ID:                     1,
-							RoleName:               "user",
-							IsAdmin:                false,
-							CreateNamespaces:       true,
-							AccesForeignNamespaces: 0,
-							MaxURLcontentSize:      5000000,
-							MaxUploadFileSize:      10000000000,
+							ID:       1,
+							RoleName: "user",
+							Permissions: PermissionUploadFiles | PermissionUploadURLs | PermissionPublish |
+								PermissionEditFiles | PermissionDeleteFiles | PermissionManageAttributes | PermissionCreateNamespaces,
+							MaxURLcontentSize: 5000000,
+							MaxUploadFileSize: 10000000000,
 						},
 						{
-							ID:                     2,
-							RoleName:               "admin",
-							IsAdmin:                true,
-							CreateNamespaces:       true,
-							AccesForeignNamespaces: 3,
-							MaxURLcontentSize:      -1,
-							MaxUploadFileSize:      10000000,
+							ID:                2,
+							RoleName:          "admin",
+							Permissions:       AllPermissions(),
+							MaxURLcontentSize: -1,
+							MaxUploadFileSize: 10000000,
 						},
 					},
 				},
@@ -193,71 +356,187 @@ func InitConfig(confFile string, createMode bool) (*Config, bool) {
 		}
 	}
 
-	if err = configService.Load(&config, confFile); err != nil {
+	loaded, err := LoadConfig(confFile)
+	if err != nil {
 		log.Fatalln(err.Error())
 		return nil, true
 	}
 
-	return &config, false
+	return loaded, false
 }
 
-// Check check the config file of logical errors
-func (config *Config) Check() bool {
+// LoadConfig loads the config from confFile. Settings
+// can be overridden by env vars like DM_SERVER_DATABASE_HOST
+// or DM_SERVER_DATABASE_PASS_FILE to read them from a file
+func LoadConfig(confFile string) (*Config, error) {
+	if err := loadConfigEnvFiles(); err != nil {
+		return nil, err
+	}
+
+	loader := configService.New(&configService.Config{
+		ENVPrefix: ConfigEnvPrefix,
+	})
+
+	var config Config
+	if err := loader.Load(&config, confFile); err != nil {
+		return nil, err
+	}
+
+	config.file = confFile
+	return &config, nil
+}
+
+// Validate checks the config for logical errors without changing anything
+func (config *Config) Validate() error {
 	if !config.Webserver.HTTP.Enabled && !config.Webserver.HTTPS.Enabled {
-		log.Error("You must at least enable one of the server protocols!")
-		return false
+		return errors.New("You must at least enable one of the server protocols!")
 	}
 
 	if config.Webserver.HTTPS.Enabled {
 		if len(config.Webserver.HTTPS.CertFile) == 0 || len(config.Webserver.HTTPS.KeyFile) == 0 {
-			log.Error("If you enable TLS you need to set CertFile and KeyFile!")
-			return false
+			return errors.New("If you enable TLS you need to set CertFile and KeyFile!")
 		}
 		//Check SSL files
 		if !gaw.FileExists(config.Webserver.HTTPS.CertFile) {
-			log.Error("Can't find the SSL certificate. File not found")
-			return false
+			return errors.New("Can't find the SSL certificate. File not found")
 		}
 		if !gaw.FileExists(config.Webserver.HTTPS.KeyFile) {
-			log.Error("Can't find the SSL key. File not found")
-			return false
+			return errors.New("Can't find the SSL key. File not found")
+		}
+		//Check client certificate authentication
+		if len(config.Webserver.HTTPS.ClientCAFile) > 0 && !gaw.FileExists(config.Webserver.HTTPS.ClientCAFile) {
+			return errors.New("Can't find the client CA file. File not found")
+		}
+		if config.Webserver.HTTPS.RequireClientCert && len(config.Webserver.HTTPS.ClientCAFile) == 0 {
+			return errors.New("Requiring client certificates needs a ClientCAFile")
+		}
+		if !gaw.IsInStringArray(config.Webserver.HTTPS.ClientCertUsername, ClientCertUsernameFields) {
+			return fmt.Errorf("Invalid ClientCertUsername. Use one of %s", strings.Join(ClientCertUsernameFields, ", "))
+		}
+	}
+
+	if len(config.Server.LogLevel) > 0 {
+		if _, err := log.ParseLevel(config.Server.LogLevel); err != nil {
+			return fmt.Errorf("Invalid log level: %s", config.Server.LogLevel)
 		}
 	}
 
 	if config.Server.Database.Type != "sqlite" && config.Server.Database.Type != "postgres" {
-		log.Errorf("Unsupported database type: %s", config.Server.Database.Type)
-		return false
+		return fmt.Errorf("Unsupported database type: %s", config.Server.Database.Type)
 	}
 
 	if config.Server.Database.Type == "postgres" {
 		// Check DB port
 		if config.Server.Database.DatabasePort < 1 || config.Server.Database.DatabasePort > 65535 {
-			log.Errorf("Invalid port for database %d\n", config.Server.Database.DatabasePort)
-			return false
+			return fmt.Errorf("Invalid port for database %d", config.Server.Database.DatabasePort)
+		}
+	}
+
+	// Check password hashing parameters
+	hashing := config.Server.PasswordHashing
+	if hashing.Iterations < 1 || hashing.Parallelism < 1 || hashing.Memory < 8*uint32(hashing.Parallelism) {
+		return errors.New("Invalid password hashing parameters")
+	}
+	if hashing.SaltLength < 8 || hashing.KeyLength < 16 {
+		return errors.New("Password hashing salt must be at least 8 and key at least 16 bytes long")
+	}
+
+	// Check login protection
+	if protection := config.Server.LoginProtection; protection.Enabled {
+		if protection.Lockout <= 0 || protection.MaxLockout < protection.Lockout {
+			return errors.New("The lockout must be positive and not exceed the max lockout")
+		}
+	}
+
+	// Check session lifetimes
+	if config.Server.SessionIdleTimeout < 0 || config.Server.SessionMaxLifetime < 0 || config.Server.AuditRetention < 0 || config.Server.ChangeRetention < 0 {
+		return errors.New("Session lifetimes and retentions can't be negative. Use 0 to disable them")
+	}
+
+	// Check webhooks
+	if webhooks := config.Server.Webhooks; webhooks.Enabled {
+		if webhooks.Timeout <= 0 || webhooks.RetryDelay <= 0 || webhooks.MaxRetryDelay < webhooks.RetryDelay || webhooks.MaxAttempts == 0 {
+			return errors.New("Invalid webhook timeout, retry delays or attempts")
+		}
+		if webhooks.DeliveryRetention < 0 {
+			return errors.New("The webhook delivery retention can't be negative. Use 0 to disable it")
+		}
+		for _, network := range webhooks.AllowedNetworks {
+			if parseIPNet(network) == nil {
+				return fmt.Errorf("Invalid allowed webhook network '%s'. Use an IP or CIDR", network)
+			}
+		}
+	}
+
+	// Check trusted proxies
+	for _, proxy := range config.Webserver.TrustedProxies {
+		if parseIPNet(proxy) == nil {
+			return fmt.Errorf("Invalid trusted proxy '%s'. Use an IP or CIDR", proxy)
+		}
+	}
+
+	// Check LDAP
+	if ldap := config.Server.LDAP; ldap.Enabled {
+		if len(ldap.URL) == 0 || len(ldap.BaseDN) == 0 {
+			return errors.New("LDAP requires an URL and a BaseDN")
+		}
+
+		if strings.Count(ldap.UserFilter, "%s") != 1 {
+			return fmt.Errorf("The LDAP UserFilter must contain exactly one %q for the username", "%s")
+		}
+	}
+
+	// Check OIDC
+	if oidc := config.Server.OIDC; oidc.Enabled {
+		if len(oidc.Issuer) == 0 || len(oidc.ClientID) == 0 {
+			return errors.New("OIDC requires an Issuer and a ClientID")
 		}
 	}
 
+	// Check proxy authentication
+	if proxyAuth := config.Server.ProxyAuth; proxyAuth.Enabled {
+		if len(proxyAuth.TrustedProxies) == 0 {
+			return errors.New("Proxy authentication requires at least one trusted proxy")
+		}
+
+		for _, proxy := range proxyAuth.TrustedProxies {
+			if parseIPNet(proxy) == nil {
+				return fmt.Errorf("Invalid authentication proxy '%s'. Use an IP or CIDR", proxy)
+			}
+		}
+	}
+
+	// Check roles used for seeding the database
+	for _, role := range config.Server.Roles.Roles {
+		if role.Validate(config) != nil {
+			return fmt.Errorf("Role '%s' is invalid. Its upload filesize must not be bigger than the server allows", role.RoleName)
+		}
+	}
+
+	return nil
+}
+
+// Check check the config file of logical errors
+// and creates the file storage dir if missing
+func (config *Config) Check() bool {
+	if err := config.Validate(); err != nil {
+		log.Error(err)
+		return false
+	}
+
 	// Check file exists file storage dir
 	if !DirExists(config.Server.PathConfig.FileStore) {
 		err := os.Mkdir(config.Server.PathConfig.FileStore, 0700)
 		if err != nil {
-			log.Fatal(err)
+			log.Error(err)
 			return false
 		}
 		log.Infof("Filestorage path '%s' created", config.Server.PathConfig.FileStore)
 	}
 
-	// Check default role
-	if config.GetDefaultRole() == nil {
-		log.Fatalln("Can't find default role. You need to specify the ID of the role to use as default")
-		return false
-	}
-
-	// Check if role can upload more than servers max filesize
 	for _, role := range config.Server.Roles.Roles {
-		if role.MaxUploadFileSize > config.Webserver.MaxUploadFileLength {
-			log.Fatalln("Role has bigger uploadfilesize than server will allow")
-			return false
+		if role.Permissions == NoPermission {
+			log.Warnf("Role '%s' doesn't grant any permissions", role.RoleName)
 		}
 	}
 
@@ -290,15 +569,67 @@ func (config Config) GetTemplateFile(fileName string) string {
 	return path.Join(config.Webserver.HTMLFiles, "templates", fileName)
 }
 
-// GetDefaultRole return the path and file for an uploaded file
-func (config Config) GetDefaultRole() *Role {
-	for rI, role := range config.Server.Roles.Roles {
-		if role.ID == config.Server.Roles.DefaultRole {
-			return &config.Server.Roles.Roles[rI]
+// IsTrustedProxy returns true if ip belongs to a trusted reverse proxy
+func (config Config) IsTrustedProxy(ip net.IP) bool {
+	return containsIP(config.Webserver.TrustedProxies, ip)
+}
+
+// IsAuthProxy returns true if ip belongs to a reverse
+// proxy which is allowed to authenticate users
+func (config Config) IsAuthProxy(ip net.IP) bool {
+	return config.Server.ProxyAuth.Enabled && containsIP(config.Server.ProxyAuth.TrustedProxies, ip)
+}
+
+// IsWebhookTarget returns true if webhooks can be delivered to ip.
+// Internal addresses must be part of the allowed networks
+func (config Config) IsWebhookTarget(ip net.IP) bool {
+	return ip != nil && (containsIP(config.Server.Webhooks.AllowedNetworks, ip) || !isInternalIP(ip))
+}
+
+// Returns true if ip belongs to the local host or a private network
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() || ip.IsLinkLocalUnicast() ||
+		containsIP(internalNetworks, ip)
+}
+
+// Returns true if ip is contained in one of the IPs or CIDRs
+func containsIP(list []string, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, item := range list {
+		if ipNet := parseIPNet(item); ipNet != nil && ipNet.Contains(ip) {
+			return true
 		}
 	}
 
-	return nil
+	return false
+}
+
+// Parse an IP or CIDR into an IPNet
+func parseIPNet(s string) *net.IPNet {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil
+		}
+
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 8 * net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil
+	}
+
+	return ipNet
 }
 
 // DirExists returns true if dir exists
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	// ConfigEnvPrefix prefix of env vars overriding
+	// settings, eg. DM_SERVER_DATABASE_HOST
+	ConfigEnvPrefix = "DM"
+
+	// Suffix of env vars containing the file to read a setting from
+	configEnvFileSuffix = "_FILE"
+
+	// Replacement of secrets in printed configs
+	maskedSecret = "********"
+)
+
+// Env vars set from files. These are
+// read again if the config is reloaded
+var configEnvFiles = struct {
+	sync.Mutex
+	set map[string]bool
+}{
+	set: make(map[string]bool),
+}
+
+// Set the env vars of settings passed as file, eg.
+// DM_SERVER_DATABASE_PASS_FILE=/run/secrets/dbpass
+func loadConfigEnvFiles() error {
+	configEnvFiles.Lock()
+	defer configEnvFiles.Unlock()
+
+	for _, name := range configEnvNames(reflect.TypeOf(Config{}), ConfigEnvPrefix) {
+		file, ok := os.LookupEnv(name + configEnvFileSuffix)
+		if !ok {
+			continue
+		}
+
+		// Values set directly win over files
+		if _, ok := os.LookupEnv(name); ok && !configEnvFiles.set[name] {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		if err = os.Setenv(name, strings.TrimRight(string(content), "\r\n")); err != nil {
+			return err
+		}
+
+		configEnvFiles.set[name] = true
+	}
+
+	return nil
+}
+
+// Returns the env var names of all settings in t
+func configEnvNames(t reflect.Type, prefix string) []string {
+	var names []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+
+		name := prefix + "_" + strings.ToUpper(field.Name)
+		if field.Type.Kind() == reflect.Struct {
+			names = append(names, configEnvNames(field.Type, name)...)
+		} else {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Masked returns a copy of config with its secrets replaced
+func (config Config) Masked() Config {
+	maskSecrets(reflect.ValueOf(&config).Elem())
+	return config
+}
+
+// Replace the non empty fields tagged as secret
+func maskSecrets(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		if field.Kind() == reflect.Struct {
+			maskSecrets(field)
+		} else if v.Type().Field(i).Tag.Get("secret") == "true" && field.Kind() == reflect.String && field.Len() > 0 {
+			field.SetString(maskedSecret)
+		}
+	}
+}
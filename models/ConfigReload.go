@@ -0,0 +1,174 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorInvalidConfig error if a reloaded config is invalid
+var ErrorInvalidConfig = errors.New("invalid config")
+
+var (
+	// Config used for new requests and background
+	// jobs. Replaced on reloads
+	liveConfig atomic.Value
+
+	// Config the server started with. Settings
+	// requiring a restart are compared to it
+	startupConfig *Config
+
+	// Prevents concurrent reloads from losing changes
+	reloadMx sync.Mutex
+)
+
+// Settings which can change without a restart. Nested
+// settings of a listed struct can change as well
+var liveSettings = []string{
+	"Server.LogLevel",
+	"Server.AllowRegistration",
+	"Server.SearchInOtherNamespaces",
+	"Server.TOTPIssuer",
+	"Server.LoginProtection",
+	"Server.DeleteUnusedSessionsAfter",
+	"Server.SessionIdleTimeout",
+	"Server.SessionMaxLifetime",
+	"Server.AuditRetention",
+	"Server.ChangeRetention",
+	"Server.Webhooks.Timeout",
+	"Server.Webhooks.MaxAttempts",
+	"Server.Webhooks.RetryDelay",
+	"Server.Webhooks.MaxRetryDelay",
+	"Server.Webhooks.DeliveryRetention",
+	"Server.Webhooks.AllowedNetworks",
+	"Webserver.MaxHeaderLength",
+	"Webserver.MaxRequestBodyLength",
+	"Webserver.MaxUploadFileLength",
+	"Webserver.DownloadFileBuffer",
+	"Webserver.UserAgentsRawfile",
+	"Webserver.MaxPreviewFilesize",
+	"Webserver.SchemeOverwrite",
+	"Webserver.TrustedProxies",
+	"Webserver.AceTheme",
+}
+
+// ConfigChanges settings changed by reloading the config
+type ConfigChanges struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requiresRestart"`
+}
+
+// SetLiveConfig sets the config the server started with
+func SetLiveConfig(config *Config) {
+	reloadMx.Lock()
+	defer reloadMx.Unlock()
+
+	startupConfig = config
+	liveConfig.Store(config)
+}
+
+// LiveConfig returns the config with the
+// settings of the last reload applied
+func LiveConfig() *Config {
+	return liveConfig.Load().(*Config)
+}
+
+// ReloadConfig loads the config file again and applies the
+// settings which can change live. Settings requiring a
+// restart are reported until the server was restarted
+func ReloadConfig() (*ConfigChanges, error) {
+	reloadMx.Lock()
+	defer reloadMx.Unlock()
+
+	newConfig, err := LoadConfig(startupConfig.file)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = newConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrorInvalidConfig, err)
+	}
+
+	reloaded := *startupConfig
+	changes := &ConfigChanges{
+		RequiresRestart: []string{},
+	}
+
+	for _, name := range changedSettings(reflect.ValueOf(*startupConfig), reflect.ValueOf(*newConfig), "") {
+		if !isLiveSetting(name) {
+			changes.RequiresRestart = append(changes.RequiresRestart, name)
+			continue
+		}
+
+		setting(reflect.ValueOf(&reloaded).Elem(), name).Set(setting(reflect.ValueOf(newConfig).Elem(), name))
+	}
+
+	// Applied are the live settings changed since the last reload
+	changes.Applied = append([]string{}, changedSettings(reflect.ValueOf(*LiveConfig()), reflect.ValueOf(reloaded), "")...)
+
+	reloaded.ApplyLogLevel()
+	liveConfig.Store(&reloaded)
+
+	log.WithFields(log.Fields{
+		"applied":         changes.Applied,
+		"requiresRestart": changes.RequiresRestart,
+	}).Info("Reloaded config")
+
+	return changes, nil
+}
+
+// ApplyLogLevel sets the configured log level if there is one
+func (config *Config) ApplyLogLevel() {
+	if len(config.Server.LogLevel) == 0 {
+		return
+	}
+
+	if level, err := log.ParseLevel(config.Server.LogLevel); err == nil {
+		log.SetLevel(level)
+	}
+}
+
+// Returns the names of the exported settings which differ between a and b
+func changedSettings(a, b reflect.Value, prefix string) []string {
+	var changed []string
+
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+
+		name := prefix + field.Name
+		if field.Type.Kind() == reflect.Struct {
+			changed = append(changed, changedSettings(a.Field(i), b.Field(i), name+".")...)
+		} else if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
+
+// Returns the setting with the dot separated name
+func setting(v reflect.Value, name string) reflect.Value {
+	for _, field := range strings.Split(name, ".") {
+		v = v.FieldByName(field)
+	}
+
+	return v
+}
+
+func isLiveSetting(name string) bool {
+	for _, live := range liveSettings {
+		if name == live || strings.HasPrefix(name, live+".") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLiveSettings(t *testing.T) {
+	for _, name := range liveSettings {
+		// Walk the types first as setting panics on unknown fields
+		typ := reflect.TypeOf(Config{})
+		for _, part := range strings.Split(name, ".") {
+			if typ.Kind() != reflect.Struct {
+				t.Fatalf("%s: %s isn't part of a struct", name, part)
+			}
+
+			field, ok := typ.FieldByName(part)
+			if !ok || len(field.PkgPath) > 0 {
+				t.Fatalf("%s: no exported field %s", name, part)
+			}
+
+			typ = field.Type
+		}
+
+		if !setting(reflect.ValueOf(&Config{}).Elem(), name).CanSet() {
+			t.Errorf("%s can't be set", name)
+		}
+	}
+}
+
+func TestIsLiveSetting(t *testing.T) {
+	tests := []struct {
+		name string
+		live bool
+	}{
+		{"Server.LogLevel", true},
+		{"Server.LoginProtection.MaxLockout", true},
+		{"Server.Webhooks.Timeout", true},
+		{"Server.Webhooks.Enabled", false},
+		{"Server.LogLevelX", false},
+		{"Server.Database.Host", false},
+		{"Webserver.TrustedProxies", true},
+	}
+
+	for _, test := range tests {
+		if live := isLiveSetting(test.name); live != test.live {
+			t.Errorf("%s: expected live %v, got %v", test.name, test.live, live)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseIPNet(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"127.0.0.1", "127.0.0.1/32"},
+		{"::1", "::1/128"},
+		{"::ffff:127.0.0.1", "127.0.0.1/32"},
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"10.1.2.3/8", "10.0.0.0/8"},
+		{"fd00::/8", "fd00::/8"},
+		{"", ""},
+		{"localhost", ""},
+		{"10.0.0.0/33", ""},
+		{"10.0.0.0/", ""},
+		{"256.0.0.1", ""},
+	}
+
+	for _, test := range tests {
+		ipNet := parseIPNet(test.input)
+		if test.want == "" {
+			if ipNet != nil {
+				t.Errorf("%q: expected nil, got %v", test.input, ipNet)
+			}
+			continue
+		}
+
+		if ipNet == nil || ipNet.String() != test.want {
+			t.Errorf("%q: expected %s, got %v", test.input, test.want, ipNet)
+		}
+	}
+}
+
+func TestIsWebhookTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      string
+		allowed []string
+		want    bool
+	}{
+		{"public IPv4", "93.184.216.34", nil, true},
+		{"public IPv6", "2606:2800:220:1:248:1893:25c8:1946", nil, true},
+		{"loopback", "127.0.0.1", nil, false},
+		{"loopback range", "127.1.2.3", nil, false},
+		{"IPv6 loopback", "::1", nil, false},
+		{"mapped loopback", "::ffff:127.0.0.1", nil, false},
+		{"mapped private", "::ffff:10.0.0.1", nil, false},
+		{"unspecified", "0.0.0.0", nil, false},
+		{"IPv6 unspecified", "::", nil, false},
+		{"this network", "0.1.2.3", nil, false},
+		{"metadata", "169.254.169.254", nil, false},
+		{"IPv6 link-local", "fe80::1", nil, false},
+		{"multicast", "224.0.0.1", nil, false},
+		{"rfc1918 10/8", "10.1.2.3", nil, false},
+		{"rfc1918 172.16/12", "172.31.255.255", nil, false},
+		{"outside 172.16/12", "172.32.0.1", nil, true},
+		{"rfc1918 192.168/16", "192.168.1.1", nil, false},
+		{"carrier-grade NAT", "100.64.0.1", nil, false},
+		{"benchmarking", "198.18.0.1", nil, false},
+		{"unique local", "fd00::1", nil, false},
+		{"allowed network", "10.1.2.3", []string{"10.0.0.0/8"}, true},
+		{"allowed single IP", "192.168.1.1", []string{"192.168.1.1"}, true},
+		{"other allowed network", "192.168.1.2", []string{"192.168.1.1", "10.0.0.0/8"}, false},
+		{"allowed loopback", "127.0.0.1", []string{"127.0.0.0/8"}, true},
+		{"allowed mapped loopback", "::ffff:127.0.0.1", []string{"127.0.0.1"}, true},
+		{"allowed metadata", "169.254.169.254", []string{"169.254.169.254/32"}, true},
+		{"invalid allowed network", "10.1.2.3", []string{"10.0.0.0/33"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{}
+			config.Server.Webhooks.AllowedNetworks = test.allowed
+
+			if got := config.IsWebhookTarget(net.ParseIP(test.ip)); got != test.want {
+				t.Errorf("%s: expected %v, got %v", test.ip, test.want, got)
+			}
+		})
+	}
+
+	if (Config{}).IsWebhookTarget(nil) {
+		t.Error("nil IP accepted")
+	}
+}
@@ -0,0 +1,269 @@
+package models
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	libdm "github.com/DataManager-Go/libdatamanager"
+	"gorm.io/gorm"
+)
+
+// ExportAccount account metadata in a data export
+type ExportAccount struct {
+	ID          uint      `json:"id"`
+	Username    string    `json:"username"`
+	Role        string    `json:"role"`
+	Created     time.Time `json:"created"`
+	Disabled    bool      `json:"disabled"`
+	TOTPEnabled bool      `json:"totp"`
+}
+
+// ExportNamespace a namespace in a data export
+type ExportNamespace struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Tags    []string  `json:"tags"`
+	Groups  []string  `json:"groups"`
+}
+
+// ExportFile file metadata in a data export
+type ExportFile struct {
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	Namespace  string    `json:"ns"`
+	Path       string    `json:"path,omitempty"`
+	Size       int64     `json:"size"`
+	Type       string    `json:"type,omitempty"`
+	Checksum   string    `json:"checksum"`
+	Encryption string    `json:"encryption,omitempty"`
+	Created    time.Time `json:"created"`
+	Public     bool      `json:"public"`
+	PublicName string    `json:"publicName,omitempty"`
+	Tags       []string  `json:"tags"`
+	Groups     []string  `json:"groups"`
+}
+
+// ExportSession a login session in a data export
+type ExportSession struct {
+	Created   time.Time `json:"created"`
+	LastUsed  time.Time `json:"lastUsed"`
+	IP        string    `json:"ip"`
+	MachineID string    `json:"mid,omitempty"`
+	Requests  int64     `json:"requests"`
+}
+
+// Export everything stored about a user
+type Export struct {
+	Exported   time.Time         `json:"exported"`
+	Account    ExportAccount     `json:"account"`
+	Namespaces []ExportNamespace `json:"namespaces"`
+	Files      []ExportFile      `json:"files"`
+	Sessions   []ExportSession   `json:"sessions"`
+}
+
+// Name of the metadata file in export archives
+const exportMetadataFile = "account.json"
+
+// ExportData writes a zip archive containing all files of the user
+// in a namespace/filename layout and a JSON dump of its metadata
+func (user *User) ExportData(db *gorm.DB, config *Config, w io.Writer) error {
+	export, files, err := user.collectExport(db)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+
+	// Add files. Use unique names since
+	// filenames aren't unique in namespaces
+	usedPaths := make(map[string]bool)
+	for i := range files {
+		filePath := exportFilePath(files[i], usedPaths)
+
+		if err := addFileToArchive(archive, config.GetStorageFile(files[i].LocalName), filePath, files[i].CreatedAt); err != nil {
+			// Keep exporting if a file is missing on disk
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+
+		export.Files[i].Path = filePath
+	}
+
+	// Add metadata
+	metadata, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     exportMetadataFile,
+		Method:   zip.Deflate,
+		Modified: export.Exported,
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(metadata)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(export); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// Collect all metadata of the user
+func (user *User) collectExport(db *gorm.DB) (*Export, []File, error) {
+	export := Export{
+		Exported: time.Now(),
+		Account: ExportAccount{
+			ID:          user.ID,
+			Username:    user.Username,
+			Created:     user.CreatedAt,
+			Disabled:    user.Disabled,
+			TOTPEnabled: user.HasTOTP(),
+		},
+		Namespaces: []ExportNamespace{},
+		Files:      []ExportFile{},
+		Sessions:   []ExportSession{},
+	}
+
+	if user.Role != nil {
+		export.Account.Role = user.Role.RoleName
+	}
+
+	// Namespaces including their tags and groups
+	namespaces, err := FindUserNamespaces(db, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range namespaces {
+		var tags []Tag
+		if err = db.Where(&Tag{NamespaceID: namespaces[i].ID, UserID: user.ID}).Find(&tags).Error; err != nil {
+			return nil, nil, err
+		}
+
+		var groups []Group
+		if err = db.Where(&Group{NamespaceID: namespaces[i].ID, UserID: user.ID}).Find(&groups).Error; err != nil {
+			return nil, nil, err
+		}
+
+		export.Namespaces = append(export.Namespaces, ExportNamespace{
+			Name:    namespaces[i].Name,
+			Created: namespaces[i].CreatedAt,
+			Tags:    TagArrToStringArr(tags),
+			Groups:  GroupArrToStringArr(groups),
+		})
+	}
+
+	// Files uploaded by the user
+	var files []File
+	err = db.Where(&File{UserID: user.ID}).Preload("Namespace").Preload("Tags").Preload("Groups").Order("id").Find(&files).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, file := range files {
+		item := ExportFile{
+			ID:        file.ID,
+			Name:      file.Name,
+			Namespace: exportNamespaceName(file),
+			Size:      file.FileSize,
+			Type:      file.FileType,
+			Checksum:  file.Checksum,
+			Created:   file.CreatedAt,
+			Public:    file.IsPublic,
+			Tags:      TagArrToStringArr(file.Tags),
+			Groups:    GroupArrToStringArr(file.Groups),
+		}
+
+		if file.PublicFilename.Valid {
+			item.PublicName = file.PublicFilename.String
+		}
+
+		if file.Encryption.Valid {
+			item.Encryption = libdm.ChiperToString(file.Encryption.Int32)
+		}
+
+		export.Files = append(export.Files, item)
+	}
+
+	// Sessions
+	sessions, err := GetUserSessions(db, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range sessions {
+		export.Sessions = append(export.Sessions, ExportSession{
+			Created:   sessions[i].CreatedAt,
+			LastUsed:  sessions[i].LastUsed,
+			IP:        sessions[i].IP,
+			MachineID: sessions[i].MachineID,
+			Requests:  sessions[i].Requests,
+		})
+	}
+
+	return &export, files, nil
+}
+
+// Return a unique path for file inside the archive
+func exportFilePath(file File, usedPaths map[string]bool) string {
+	dir := sanitizeExportName(exportNamespaceName(file))
+	name := sanitizeExportName(file.Name)
+
+	filePath := path.Join("files", dir, name)
+	if usedPaths[filePath] {
+		ext := path.Ext(name)
+		filePath = path.Join("files", dir, fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), file.ID, ext))
+	}
+
+	usedPaths[filePath] = true
+	return filePath
+}
+
+// Return the name of the files namespace
+func exportNamespaceName(file File) string {
+	if file.Namespace == nil {
+		return ""
+	}
+
+	return file.Namespace.Name
+}
+
+// Make name safe to use as a single path element
+func sanitizeExportName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if len(name) == 0 || name == "." || name == ".." {
+		return "_"
+	}
+
+	return name
+}
+
+// Copy a local file into the archive
+func addFileToArchive(archive *zip.Writer, localFile, name string, modified time.Time) error {
+	f, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	writer, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, f)
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/DataManager-Go/DataManagerServer/metrics"
 	libdm "github.com/DataManager-Go/libdatamanager"
 
 	"github.com/JojiiOfficial/gaw"
@@ -250,31 +251,55 @@ func (file File) HasGroup(sGroup string) bool {
 	return false
 }
 
-// Delete deletes a file
+// Delete deletes a file and records it in the change log.
+// The local file is shredded once the deletion is committed
 func (file *File) Delete(db *gorm.DB, config *Config) error {
-	// Remove public filename to free this keyword
-	file.IsPublic = false
-	file.PublicFilename = sql.NullString{
-		Valid: false,
-	}
+	var job *ShredJob
+
+	err := WithChanges(db, func(tx *gorm.DB, changes *ChangeLog) error {
+		// Remove public filename to free this keyword
+		file.IsPublic = false
+		file.PublicFilename = sql.NullString{
+			Valid: false,
+		}
+
+		// Save new state
+		if err := file.Save(tx); err != nil {
+			return err
+		}
+
+		// Store the shred job along with the deletion
+		localFile := config.GetStorageFile(file.LocalName)
+		if s, err := os.Stat(localFile); err != nil {
+			log.Warn(err)
+		} else {
+			job = &ShredJob{
+				LocalFile: localFile,
+				Size:      s.Size(),
+			}
 
-	// Save new state
-	err := file.Save(db)
+			if err = tx.Create(job).Error; err != nil {
+				return err
+			}
+		}
+
+		// Delete from DB
+		if err := tx.Delete(&file).Error; err != nil {
+			return err
+		}
+
+		return changes.Record(file.NamespaceID, ChangeFile, ChangeDeleted, file.ID, file.Name)
+	})
 	if err != nil {
 		return err
 	}
 
-	localFile := config.GetStorageFile(file.LocalName)
-	s, err := os.Stat(localFile)
-	if err != nil {
-		log.Warn(err)
-	} else {
-		// Shredder file in background
-		go ShredderFile(localFile, s.Size())
+	// Shredder file in background
+	if job != nil {
+		runShredJob(db, job)
 	}
 
-	// Delete from DB
-	return db.Delete(&file).Error
+	return nil
 }
 
 // ShredderFile shreddres a file
@@ -300,18 +325,27 @@ func ShredderFile(localFile string, size int64) {
 		shredConfig = shred.NewShredderConf(&shredder, shred.WriteZeros|shred.WriteRandSecure, 3, true)
 	}
 
+	metrics.ActiveShredJobs.Inc()
+	defer metrics.ActiveShredJobs.Dec()
+
 	// Shredder & Delete local file
 	start := time.Now()
 	err := shredConfig.ShredFile(localFile)
 	if err != nil {
 		log.Error(err)
+		metrics.ShredJobs.WithLabelValues("error").Inc()
+
 		// Delete file if shredder didn't
 		err = os.Remove(localFile)
 		if err != nil {
 			log.Warn(err)
 		}
+	} else {
+		metrics.ShredJobs.WithLabelValues("success").Inc()
+		metrics.ShredBytes.Add(float64(size))
 	}
 
+	metrics.ShredDuration.Observe(time.Since(start).Seconds())
 	log.Debug("Shredding took ", time.Since(start).String())
 }
 
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Length of the random part of invite codes
+const inviteCodeLength = 24
+
+var (
+	// ErrorInvalidInvite error if an invite code doesn't exist, expired or is used up
+	ErrorInvalidInvite = errors.New("invalid invite")
+
+	// ErrorInviteNotFound error if an invite doesn't exist
+	ErrorInviteNotFound = errors.New("invite not found")
+)
+
+// Invite an invite code which allows to register
+// users with the assigned role
+type Invite struct {
+	gorm.Model
+	CodeHash  string `gorm:"uniqueIndex;not null"`
+	CreatorID uint   `gorm:"index"`
+	Creator   *User  `gorm:"association_autoupdate:false;association_autocreate:false"`
+	RoleID    uint
+	Role      *Role `gorm:"association_autoupdate:false;association_autocreate:false"`
+	MaxUses   uint
+	Uses      uint
+	ExpiresAt time.Time
+}
+
+// CreateInvite creates an invite for role which can be used maxUses
+// times. It never expires if validFor is 0. Returns the invite code
+func CreateInvite(db *gorm.DB, creator *User, role *Role, maxUses uint, validFor time.Duration) (*Invite, string, error) {
+	code, err := randomInviteCode()
+	if err != nil {
+		return nil, "", err
+	}
+
+	invite := Invite{
+		CodeHash:  hashInviteCode(code),
+		CreatorID: creator.ID,
+		Creator:   creator,
+		RoleID:    role.ID,
+		Role:      role,
+		MaxUses:   maxUses,
+	}
+
+	if validFor > 0 {
+		invite.ExpiresAt = time.Now().Add(validFor)
+	}
+
+	if err = db.Create(&invite).Error; err != nil {
+		return nil, "", err
+	}
+
+	return &invite, code, nil
+}
+
+// GetInvites returns all invites created by creatorID.
+// Returns the invites of all users if creatorID is 0
+func GetInvites(db *gorm.DB, creatorID uint) ([]Invite, error) {
+	var invites []Invite
+
+	query := db.Preload("Creator").Preload("Role").Order("id")
+	if creatorID != 0 {
+		query = query.Where(&Invite{CreatorID: creatorID})
+	}
+
+	return invites, query.Find(&invites).Error
+}
+
+// FindInvite finds an invite by its ID
+func FindInvite(db *gorm.DB, id uint) (*Invite, error) {
+	var invite Invite
+	if err := db.First(&invite, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrorInviteNotFound
+		}
+
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+// IsExpired returns true if the invite can't be used anymore
+func (invite Invite) IsExpired() bool {
+	return invite.Uses >= invite.MaxUses || (!invite.ExpiresAt.IsZero() && invite.ExpiresAt.Before(time.Now()))
+}
+
+// Revoke deletes the invite
+func (invite *Invite) Revoke(db *gorm.DB) error {
+	return db.Unscoped().Delete(invite).Error
+}
+
+// RegisterWithInvite registers user with the role of the invite
+// belonging to code. The invite is used up atomically
+func (user User) RegisterWithInvite(db *gorm.DB, config *Config, code string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var invite Invite
+		err := tx.Where(&Invite{CodeHash: hashInviteCode(code)}).First(&invite).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrorInvalidInvite
+			}
+
+			return err
+		}
+
+		if invite.IsExpired() {
+			return ErrorInvalidInvite
+		}
+
+		// Only count the use if the invite
+		// wasn't used up in the meantime
+		res := tx.Model(&Invite{}).
+			Where("id = ? AND uses < max_uses", invite.ID).
+			UpdateColumn("uses", gorm.Expr("uses + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return ErrorInvalidInvite
+		}
+
+		user.RoleID = invite.RoleID
+		return user.Register(tx, config)
+	})
+}
+
+// Generate a random invite code
+func randomInviteCode() (string, error) {
+	buff := make([]byte, inviteCodeLength/2)
+	if _, err := rand.Read(buff); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buff), nil
+}
+
+// Hash an invite code to store it
+func hashInviteCode(code string) string {
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// AuthSourceLDAP auth source of users provisioned from LDAP
+const AuthSourceLDAP = "ldap"
+
+// ErrorExternalUser error if an action isn't possible
+// for users managed by an external directory
+var ErrorExternalUser = errors.New("user is managed by an external directory")
+
+// IsExternal returns true if the user is managed by an external directory
+func (user *User) IsExternal() bool {
+	return len(user.AuthSource) > 0
+}
+
+// Authenticate user against the directory and provision a local
+// user on the first login. Local users are never authenticated
+// against the directory to prevent taking over accounts
+func (user *User) authenticateLDAP(db *gorm.DB, config *Config, password string) error {
+	entry, err := config.Server.LDAP.authenticate(user.GetUsername(), password)
+	if err != nil {
+		return err
+	}
+
+	role, err := FindRole(db, config.Server.LDAP.roleForGroups(entry.GetAttributeValues(config.Server.LDAP.GroupAttribute), config))
+	if err != nil {
+		return err
+	}
+
+	// Provision new users
+	if user.ID == 0 {
+		return user.provision(db, AuthSourceLDAP, role)
+	}
+
+	// Apply changed group memberships
+	return user.syncRole(db, role)
+}
+
+// Return the role for the first matching group
+func (ldapConf ldapConfig) roleForGroups(groups []string, config *Config) uint {
+	for _, groupRole := range ldapConf.GroupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(groupRole.Group, group) {
+				return groupRole.Role
+			}
+		}
+	}
+
+	return config.Server.Roles.DefaultRole
+}
+
+// Search the user and bind as it to verify the password
+func (ldapConf ldapConfig) authenticate(username, password string) (*ldap.Entry, error) {
+	// Empty passwords result in unauthenticated binds which always succeed
+	if len(password) == 0 {
+		return nil, ErrorInvalidCredentials
+	}
+
+	conn, err := ldapConf.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := ldapConf.search(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrorInvalidCredentials
+		}
+
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// HasLDAPUser returns true if username exists in the directory
+func (config *Config) HasLDAPUser(username string) (bool, error) {
+	if !config.Server.LDAP.Enabled {
+		return false, nil
+	}
+
+	conn, err := config.Server.LDAP.connect()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	_, err = config.Server.LDAP.search(conn, (&User{Username: username}).GetUsername())
+	if err == ErrorInvalidCredentials {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Find the entry of username. Returns ErrorInvalidCredentials
+// if the user doesn't exist or isn't unique
+func (ldapConf ldapConfig) search(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(
+		ldapConf.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapConf.Timeout.Seconds()), false,
+		fmt.Sprintf(ldapConf.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", ldapConf.GroupAttribute},
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) || ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrorInvalidCredentials
+		}
+
+		return nil, err
+	}
+
+	if len(result.Entries) != 1 {
+		return nil, ErrorInvalidCredentials
+	}
+
+	return result.Entries[0], nil
+}
+
+// Connect to the directory and bind with the service account if set
+func (ldapConf ldapConfig) connect() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: ldapConf.InsecureSkipVerify, // #nosec configurable for self-signed directories
+	}
+
+	conn, err := ldap.DialURL(ldapConf.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapConf.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetTimeout(ldapConf.Timeout)
+
+	if ldapConf.StartTLS {
+		if u, err := url.Parse(ldapConf.URL); err == nil {
+			tlsConfig.ServerName = u.Hostname()
+		}
+
+		if err = conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if len(ldapConf.BindDN) > 0 {
+		err = conn.Bind(ldapConf.BindDN, ldapConf.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,215 @@
+//go:build ldap
+// +build ldap
+
+package models
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// Directory of testdata/ldap/docker-compose.yml
+const (
+	testLDAPBaseDN    = "dc=example,dc=org"
+	testLDAPAdminDN   = "cn=admin,dc=example,dc=org"
+	testLDAPAdminPass = "admin"
+	testLDAPAdmins    = "cn=admins,ou=groups,dc=example,dc=org"
+	testLDAPBobDN     = "uid=bob,ou=people,dc=example,dc=org"
+)
+
+// Config using the test directory. Its URL can be
+// changed with DM_TEST_LDAP_URL
+func newLDAPTestConfig() *Config {
+	url := os.Getenv("DM_TEST_LDAP_URL")
+	if len(url) == 0 {
+		url = "ldap://localhost:3389"
+	}
+
+	config := &Config{}
+	config.Server.LDAP = ldapConfig{
+		Enabled:        true,
+		URL:            url,
+		BindDN:         testLDAPAdminDN,
+		BindPassword:   testLDAPAdminPass,
+		BaseDN:         testLDAPBaseDN,
+		UserFilter:     "(uid=%s)",
+		GroupAttribute: "memberOf",
+		GroupRoles: []ldapGroupRole{
+			{Group: testLDAPAdmins, Role: 2},
+		},
+		Timeout: 5 * time.Second,
+	}
+
+	return config
+}
+
+// Login as username and return the loaded user
+func ldapLogin(db *gorm.DB, config *Config, username, password string) (*User, error) {
+	user := &User{Username: username, Password: password}
+	return user, user.Authenticate(db, config)
+}
+
+// Add or remove bob from the admins group
+func setLDAPAdmin(t *testing.T, config *Config, admin bool) {
+	conn, err := config.Server.LDAP.connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	request := ldap.NewModifyRequest(testLDAPAdmins, nil)
+	if admin {
+		request.Add("uniqueMember", []string{testLDAPBobDN})
+	} else {
+		request.Delete("uniqueMember", []string{testLDAPBobDN})
+	}
+
+	if err = conn.Modify(request); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLDAPLogin(t *testing.T) {
+	config := newLDAPTestConfig()
+	db := newTestDB(t, config)
+
+	// First login provisions the user with the role of its groups
+	user, err := ldapLogin(db, config, "alice", "alicepw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.ID == 0 || user.AuthSource != AuthSourceLDAP || user.RoleID != 2 {
+		t.Fatalf("alice provisioned as %d from '%s' with role %d", user.ID, user.AuthSource, user.RoleID)
+	}
+
+	if namespace := FindNamespace(db, "default", user); !namespace.IsValid() {
+		t.Error("alice has no default namespace")
+	}
+
+	// Further logins use the provisioned user
+	again, err := ldapLogin(db, config, "alice", "alicepw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.ID != user.ID {
+		t.Errorf("alice provisioned twice: %d and %d", user.ID, again.ID)
+	}
+
+	// Users without a mapped group get the default role
+	bob, err := ldapLogin(db, config, "bob", "bobpw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bob.RoleID != 1 {
+		t.Errorf("bob got role %d instead of the default role", bob.RoleID)
+	}
+}
+
+func TestLDAPInvalidCredentials(t *testing.T) {
+	config := newLDAPTestConfig()
+	db := newTestDB(t, config)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{"wrong password", "alice", "wrong"},
+		{"empty password", "alice", ""},
+		{"missing user", "nobody", "nobodypw"},
+		{"filter injection", "*", "alicepw"},
+	}
+
+	for _, test := range tests {
+		if _, err := ldapLogin(db, config, test.username, test.password); err != ErrorInvalidCredentials {
+			t.Errorf("%s: got %v instead of invalid credentials", test.name, err)
+		}
+	}
+
+	var count int64
+	if db.Model(&User{}).Count(&count); count != 0 {
+		t.Errorf("failed logins provisioned %d users", count)
+	}
+
+	if exists, err := config.HasLDAPUser("nobody"); exists || err != nil {
+		t.Errorf("missing user exists: %t, %v", exists, err)
+	}
+
+	if exists, err := config.HasLDAPUser("bob"); !exists || err != nil {
+		t.Errorf("bob doesn't exist: %v", err)
+	}
+}
+
+func TestLDAPGroupSync(t *testing.T) {
+	config := newLDAPTestConfig()
+	db := newTestDB(t, config)
+
+	bob, err := ldapLogin(db, config, "bob", "bobpw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Joining a mapped group changes the role on the next login
+	setLDAPAdmin(t, config, true)
+	joined := true
+	defer func() {
+		if joined {
+			setLDAPAdmin(t, config, false)
+		}
+	}()
+
+	if bob, err = ldapLogin(db, config, "bob", "bobpw"); err != nil {
+		t.Fatal(err)
+	}
+
+	if bob.RoleID != 2 {
+		t.Fatalf("bob has role %d after joining the admins", bob.RoleID)
+	}
+
+	// Leaving it reverts to the default role
+	setLDAPAdmin(t, config, false)
+	joined = false
+
+	if bob, err = ldapLogin(db, config, "bob", "bobpw"); err != nil {
+		t.Fatal(err)
+	}
+
+	if bob.RoleID != 1 {
+		t.Errorf("bob has role %d after leaving the admins", bob.RoleID)
+	}
+}
+
+func TestLDAPDisabledUser(t *testing.T) {
+	config := newLDAPTestConfig()
+	db := newTestDB(t, config)
+
+	alice, err := ldapLogin(db, config, "alice", "alicepw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = alice.SetDisabled(db, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ldapLogin(db, config, "alice", "alicepw"); err != ErrorUserDisabled {
+		t.Errorf("disabled user got %v", err)
+	}
+
+	// The directory isn't used for local users
+	local := User{Username: "bob", Password: "local", RoleID: 1}
+	if err = db.Create(&local).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ldapLogin(db, config, "bob", "bobpw"); err != ErrorInvalidCredentials {
+		t.Errorf("local user logged in with the directory password: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// LoginFailure failed login or registration
+// attempts of an IP address or a username
+type LoginFailure struct {
+	ID          uint   `gorm:"primarykey"`
+	Subject     string `gorm:"uniqueIndex;not null"`
+	Failures    uint
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Lockout subject prefixes
+const (
+	lockoutPrefixIP   = "ip:"
+	lockoutPrefixUser = "user:"
+)
+
+// LockoutSubjectIP returns the lockout subject for an IP address
+func LockoutSubjectIP(ip string) string {
+	return lockoutPrefixIP + ip
+}
+
+// LockoutSubjectUser returns the lockout subject for a username
+func LockoutSubjectUser(username string) string {
+	return lockoutPrefixUser + (&User{Username: username}).GetUsername()
+}
+
+// IsLocked returns true if the subject is currently locked
+func (failure LoginFailure) IsLocked() bool {
+	return failure.LockedUntil.After(time.Now())
+}
+
+// GetLockout returns the remaining lockout duration of
+// the longest locked subject. Returns 0 if none is locked
+func GetLockout(db *gorm.DB, subjects ...string) (time.Duration, error) {
+	var failures []LoginFailure
+	err := db.Where("subject IN (?) AND locked_until > ?", subjects, time.Now()).Find(&failures).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var remaining time.Duration
+	for i := range failures {
+		if left := time.Until(failures[i].LockedUntil); left > remaining {
+			remaining = left
+		}
+	}
+
+	return remaining, nil
+}
+
+// RegisterLoginFailure increases the failure counter of subject
+// and locks it with an exponential backoff if maxFailures is reached
+func RegisterLoginFailure(db *gorm.DB, config *Config, subject string, maxFailures uint) error {
+	protection := config.Server.LoginProtection
+
+	var failure LoginFailure
+	if err := db.Where(&LoginFailure{Subject: subject}).FirstOrCreate(&failure).Error; err != nil {
+		return err
+	}
+
+	// Forget old failures
+	if time.Since(failure.LastFailure) > protection.ResetAfter {
+		failure.Failures = 0
+	}
+
+	failure.Failures++
+	failure.LastFailure = time.Now()
+
+	// Lock subject. Double the duration for each further failure
+	if failure.Failures >= maxFailures {
+		failure.LockedUntil = failure.LastFailure.Add(lockoutDuration(protection, failure.Failures-maxFailures))
+
+		log.WithFields(log.Fields{
+			"subject":  subject,
+			"failures": failure.Failures,
+			"until":    failure.LockedUntil.Format(time.RFC3339),
+		}).Warn("Locked out after too many failed attempts")
+	}
+
+	return db.Save(&failure).Error
+}
+
+// Calculate the lockout duration after exceeded failures
+func lockoutDuration(protection loginProtectionConfig, exceeded uint) time.Duration {
+	// float64(MaxLockout) might be rounded up. Compare
+	// inclusively to not overflow the conversion below
+	duration := float64(protection.Lockout) * math.Pow(2, float64(exceeded))
+	if duration >= float64(protection.MaxLockout) {
+		return protection.MaxLockout
+	}
+
+	return time.Duration(duration)
+}
+
+// ResetLoginFailures removes all failures and lockouts of the subjects
+func ResetLoginFailures(db *gorm.DB, subjects ...string) (int64, error) {
+	res := db.Where("subject IN (?)", subjects).Delete(&LoginFailure{})
+	return res.RowsAffected, res.Error
+}
+
+// GetLockedSubjects returns all currently locked subjects
+func GetLockedSubjects(db *gorm.DB) ([]LoginFailure, error) {
+	var failures []LoginFailure
+	return failures, db.Where("locked_until > ?", time.Now()).Order("locked_until desc").Find(&failures).Error
+}
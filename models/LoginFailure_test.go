@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	protection := loginProtectionConfig{
+		Lockout:    time.Minute,
+		MaxLockout: time.Hour,
+	}
+
+	want := protection.Lockout
+	for exceeded := uint(0); exceeded <= 64; exceeded++ {
+		got := lockoutDuration(protection, exceeded)
+		if got != want {
+			t.Fatalf("%d exceeded failures: expected %v, got %v", exceeded, want, got)
+		}
+
+		// Double until the cap is reached
+		if want *= 2; want > protection.MaxLockout {
+			want = protection.MaxLockout
+		}
+	}
+
+	// The cap has to hold even if the duration can't be represented
+	protection.MaxLockout = time.Duration(1<<63 - 1)
+	for _, lockout := range []time.Duration{time.Nanosecond, time.Minute} {
+		protection.Lockout = lockout
+		for _, exceeded := range []uint{63, 64, 1000, ^uint(0)} {
+			if got := lockoutDuration(protection, exceeded); got != protection.MaxLockout {
+				t.Errorf("%v lockout, %d exceeded failures: expected %v, got %v", lockout, exceeded, protection.MaxLockout, got)
+			}
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package models
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/JojiiOfficial/gaw"
 	log "github.com/sirupsen/logrus"
@@ -16,6 +18,8 @@ type LoginSession struct {
 	Token     string
 	Requests  int64
 	MachineID string
+	LastUsed  time.Time
+	IP        string
 
 	mx sync.Mutex `gorm:"-"`
 }
@@ -23,8 +27,12 @@ type LoginSession struct {
 // SessionTokenLength length of session token
 const SessionTokenLength = 64
 
-//GetUserFromSession return user from session
-func GetUserFromSession(db *gorm.DB, token string) (*User, error) {
+// ErrorSessionExpired error if a session is expired
+var ErrorSessionExpired = errors.New("session expired")
+
+//GetUserFromSession return user and session from token. ip
+// is the address of the client using the session
+func GetUserFromSession(db *gorm.DB, config *Config, token, ip string) (*User, *LoginSession, error) {
 	var err error
 
 	// Try to get session from cache
@@ -33,26 +41,142 @@ func GetUserFromSession(db *gorm.DB, token string) (*User, error) {
 		// Load from DB if not cached
 		session, err = loadSession(token, db)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		// Add token to cache
 		sessionCache.addSession(session, db)
 	}
 
-	// Increase request counter
-	go func() {
-		session.mx.Lock()
-		defer session.mx.Unlock()
+	// Reject sessions of disabled users
+	if session.User != nil && session.User.Disabled {
+		return nil, nil, ErrorUserDisabled
+	}
 
-		session.Requests++
-		err = db.Model(&LoginSession{}).Save(session).Error
-		if err != nil {
+	// Revoke expired sessions
+	if session.IsExpired(config) {
+		if err := session.Revoke(db); err != nil {
 			log.Error(err)
 		}
-	}()
 
-	return session.User, nil
+		return nil, nil, ErrorSessionExpired
+	}
+
+	// Increase request counter
+	go session.trackUsage(db, ip)
+
+	return session.User, session, nil
+}
+
+// Increase the request counter and update the last usage
+func (session *LoginSession) trackUsage(db *gorm.DB, ip string) {
+	session.mx.Lock()
+	defer session.mx.Unlock()
+
+	session.Requests++
+	session.LastUsed = time.Now()
+	session.IP = ip
+
+	// Only update existing rows to
+	// not recreate revoked sessions
+	err := db.Model(&LoginSession{}).Where("id = ?", session.ID).UpdateColumns(map[string]interface{}{
+		"requests":  gorm.Expr("requests + 1"),
+		"last_used": session.LastUsed,
+		"ip":        ip,
+	}).Error
+
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// IsExpired returns true if the session exceeded
+// its idle timeout or its maximum lifetime
+func (session *LoginSession) IsExpired(config *Config) bool {
+	session.mx.Lock()
+	defer session.mx.Unlock()
+
+	lastUsed := session.LastUsed
+	if lastUsed.IsZero() {
+		lastUsed = session.CreatedAt
+	}
+
+	idleTimeout := config.Server.SessionIdleTimeout
+	if idleTimeout > 0 && time.Since(lastUsed) > idleTimeout {
+		return true
+	}
+
+	maxLifetime := config.Server.SessionMaxLifetime
+	return maxLifetime > 0 && time.Since(session.CreatedAt) > maxLifetime
+}
+
+// DeleteExpiredSessions deletes sessions which were never used within
+// DeleteUnusedSessionsAfter or which are expired. Returns the deleted count
+func DeleteExpiredSessions(db *gorm.DB, config *Config) (int64, error) {
+	now := time.Now()
+
+	// Delete where requests = 0 and creation > specified allowed time
+	query := db.Unscoped().
+		Where("requests = 0 AND created_at < ?", now.Add(-config.Server.DeleteUnusedSessionsAfter))
+
+	// Sessions created before tracking the last usage have no last_used
+	if idleTimeout := config.Server.SessionIdleTimeout; idleTimeout > 0 {
+		query = query.Or("COALESCE(last_used, created_at) < ?", now.Add(-idleTimeout))
+	}
+
+	if maxLifetime := config.Server.SessionMaxLifetime; maxLifetime > 0 {
+		query = query.Or("created_at < ?", now.Add(-maxLifetime))
+	}
+
+	res := query.Delete(&LoginSession{})
+	return res.RowsAffected, res.Error
+}
+
+// Revoke deletes the session and removes it from the cache
+func (session *LoginSession) Revoke(db *gorm.DB) error {
+	sessionCache.removeSession(session.Token)
+	return db.Unscoped().Delete(&LoginSession{}, session.ID).Error
+}
+
+// GetUserSessions returns all sessions of a user
+func GetUserSessions(db *gorm.DB, userID uint) ([]LoginSession, error) {
+	var sessions []LoginSession
+	return sessions, db.Where(&LoginSession{UserID: userID}).Order("last_used desc").Find(&sessions).Error
+}
+
+// FindUserSession finds a session of a user by its ID
+func FindUserSession(db *gorm.DB, userID, sessionID uint) (*LoginSession, error) {
+	var session LoginSession
+	err := db.Where(&LoginSession{UserID: userID}).First(&session, sessionID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// RevokeUserSessions revokes all sessions of a user except
+// the session with the ID except. Returns the revoked count
+func RevokeUserSessions(db *gorm.DB, userID, except uint) (int64, error) {
+	sessions, err := GetUserSessions(db, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var revoked int64
+	for i := range sessions {
+		if sessions[i].ID == except {
+			continue
+		}
+
+		if err := sessions[i].Revoke(db); err != nil {
+			return revoked, err
+		}
+
+		revoked++
+	}
+
+	return revoked, nil
 }
 
 func loadSession(token string, db *gorm.DB) (*LoginSession, error) {
@@ -61,7 +185,7 @@ func loadSession(token string, db *gorm.DB) (*LoginSession, error) {
 	// load session from db
 	err := db.Model(&LoginSession{}).Where(&LoginSession{
 		Token: token,
-	}).Preload("User").Preload("User.Role").Find(&ss).Error
+	}).Preload("User").Preload("User.Role").First(&ss).Error
 
 	if err != nil {
 		return nil, err
@@ -71,7 +195,7 @@ func loadSession(token string, db *gorm.DB) (*LoginSession, error) {
 }
 
 // NewSession create new login session
-func NewSession(user *User, machineID string) *LoginSession {
+func NewSession(user *User, machineID, ip string) *LoginSession {
 	if len(machineID) > 100 {
 		machineID = ""
 	}
@@ -102,5 +226,7 @@ func NewSession(user *User, machineID string) *LoginSession {
 		UserID:    user.ID,
 		User:      user,
 		MachineID: machineID,
+		LastUsed:  time.Now(),
+		IP:        ip,
 	}
 }
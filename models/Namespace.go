@@ -21,23 +21,56 @@ func GetNamespaceFromString(ns string) *Namespace {
 	}
 }
 
-// FindNamespace find namespace in DB
+// FindNamespace find a namespace the user can read. The users own
+// namespaces are preferred. Namespaces of other users are found by
+// their full name if the user is allowed to read foreign namespaces
 func FindNamespace(db *gorm.DB, ns string, user *User) *Namespace {
-	// Add username prefix if not provided
-	ns = user.GetNamespaceName(ns)
-
 	var namespace Namespace
+
+	// Add username prefix if not provided
 	err := db.Where(&Namespace{
 		UserID: user.ID,
-	}).Where("LOWER(name)=LOWER(?)", ns).Limit(1).Find(&namespace).Error
+	}).Where("LOWER(name)=LOWER(?)", user.GetNamespaceName(ns)).Limit(1).Find(&namespace).Error
 
 	if err != nil {
 		return nil
 	}
 
+	if namespace.ID == 0 && user.CanReadForeignNamespace() {
+		if err = db.Where("LOWER(name)=LOWER(?)", ns).Limit(1).Find(&namespace).Error; err != nil {
+			return nil
+		}
+	}
+
 	return &namespace
 }
 
+// FindNamespaceByName find a namespace of any user by its full name
+func FindNamespaceByName(db *gorm.DB, name string) (*Namespace, error) {
+	var namespace Namespace
+	if err := db.Where("LOWER(name)=LOWER(?)", name).First(&namespace).Error; err != nil {
+		return nil, err
+	}
+
+	return &namespace, nil
+}
+
+// GetNamespaceNames returns the names of the namespaces
+// by their ID. Includes deleted namespaces
+func GetNamespaceNames(db *gorm.DB, ids []uint) (map[uint]string, error) {
+	var namespaces []Namespace
+	if err := db.Unscoped().Select("id", "name").Where("id IN (?)", ids).Find(&namespaces).Error; err != nil {
+		return nil, err
+	}
+
+	names := make(map[uint]string, len(namespaces))
+	for i := range namespaces {
+		names[namespaces[i].ID] = namespaces[i].Name
+	}
+
+	return names, nil
+}
+
 // IsOwnedBy returns true if namespace is users
 func (namespace *Namespace) IsOwnedBy(user *User) bool {
 	if user == nil || namespace == nil {
@@ -59,6 +92,55 @@ func FindUserNamespaces(db *gorm.DB, user *User) ([]Namespace, error) {
 	return namespaces, nil
 }
 
+// FindReadableNamespaces get all namespaces the user can read
+func FindReadableNamespaces(db *gorm.DB, user *User) ([]Namespace, error) {
+	var namespaces []Namespace
+
+	err := db.Model(&Namespace{}).Scopes(ReadableNamespaces(user)).Order("name").Find(&namespaces).Error
+	if err != nil {
+		return []Namespace{}, err
+	}
+
+	return namespaces, nil
+}
+
+// ReadableNamespaces limits a query on the namespaces
+// table to the namespaces the user can read
+func ReadableNamespaces(user *User) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if user.CanReadForeignNamespace() {
+			return db
+		}
+
+		return db.Where("namespaces.creator = ?", user.ID)
+	}
+}
+
+// NamespaceUsage storage usage of a namespace
+type NamespaceUsage struct {
+	ID        uint
+	Name      string
+	Owner     string
+	FileCount int64
+	Size      int64
+}
+
+// GetNamespaceUsage returns the storage usage of all namespaces
+func GetNamespaceUsage(db *gorm.DB) ([]NamespaceUsage, error) {
+	var usage []NamespaceUsage
+
+	err := db.Table("namespaces").
+		Select("namespaces.id, namespaces.name, users.username AS owner, COUNT(files.id) AS file_count, COALESCE(SUM(files.file_size), 0) AS size").
+		Joins("LEFT JOIN users ON users.id = namespaces.creator").
+		Joins("LEFT JOIN files ON files.namespace_id = namespaces.id AND files.deleted_at IS NULL").
+		Where("namespaces.deleted_at IS NULL").
+		Group("namespaces.id, namespaces.name, users.username").
+		Order("namespaces.name").
+		Scan(&usage).Error
+
+	return usage, err
+}
+
 // IsValid return true if namespace is valid
 func (namespace *Namespace) IsValid() bool {
 	return (namespace != nil && namespace.ID > 0)
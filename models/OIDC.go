@@ -0,0 +1,459 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// AuthSourceOIDC auth source of users provisioned from an OIDC provider
+const AuthSourceOIDC = "oidc"
+
+// OIDCStateLifetime pending authorization
+// code logins expire after this duration
+const OIDCStateLifetime = 10 * time.Minute
+
+var (
+	// ErrorOIDCDisabled error if a disabled login flow is used
+	ErrorOIDCDisabled = errors.New("OIDC login flow not enabled")
+
+	// ErrorOIDCInvalidState error if the state of a callback is unknown or expired
+	ErrorOIDCInvalidState = errors.New("invalid or expired OIDC state")
+
+	// ErrorOIDCPending error if the device authorization isn't completed yet
+	ErrorOIDCPending = errors.New("authorization pending")
+
+	// ErrorOIDCSlowDown error if the device token is polled too fast
+	ErrorOIDCSlowDown = errors.New("polling too fast")
+
+	// ErrorOIDCDenied error if the authorization was denied or expired
+	ErrorOIDCDenied = errors.New("authorization denied or expired")
+
+	// ErrorOIDCMissingClaim error if the ID token doesn't contain a username
+	ErrorOIDCMissingClaim = errors.New("ID token is missing the username claim")
+)
+
+// OIDCState a pending authorization code login
+type OIDCState struct {
+	ID        uint   `gorm:"primarykey"`
+	State     string `gorm:"uniqueIndex;not null"`
+	Nonce     string
+	Verifier  string
+	MachineID string
+	CreatedAt time.Time
+}
+
+// OIDCDeviceAuthorization a started device login
+type OIDCDeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// Discovered provider of the current configuration
+type oidcClient struct {
+	key      string
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+
+	// Empty if the provider doesn't support the device flow
+	deviceAuthURL string
+}
+
+var (
+	oidcMutex  sync.Mutex
+	oidcCached *oidcClient
+
+	// Used for all requests to the provider
+	oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// Returns the client for the configured provider. Discovery
+// is done once and retried on the next call if it fails
+func (oidcConf oidcConfig) client(ctx context.Context) (*oidcClient, error) {
+	if !oidcConf.Enabled {
+		return nil, ErrorOIDCDisabled
+	}
+
+	key := strings.Join([]string{oidcConf.Issuer, oidcConf.ClientID, oidcConf.ClientSecret, oidcConf.RedirectURL, strings.Join(oidcConf.Scopes, " ")}, "\n")
+
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	if oidcCached != nil && oidcCached.key == key {
+		return oidcCached, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, oidcConf.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims struct {
+		DeviceAuthURL string `json:"device_authorization_endpoint"`
+	}
+	if err = provider.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	// Always request the openid scope
+	scopes := []string{oidc.ScopeOpenID}
+	if len(oidcConf.Scopes) == 0 {
+		scopes = append(scopes, "profile")
+	}
+	for _, scope := range oidcConf.Scopes {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	oidcCached = &oidcClient{
+		key: key,
+		oauth: oauth2.Config{
+			ClientID:     oidcConf.ClientID,
+			ClientSecret: oidcConf.ClientSecret,
+			RedirectURL:  oidcConf.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier:      provider.Verifier(&oidc.Config{ClientID: oidcConf.ClientID}),
+		deviceAuthURL: claims.DeviceAuthURL,
+	}
+
+	return oidcCached, nil
+}
+
+// Return the role for the first matching claim value
+func (oidcConf oidcConfig) roleForClaim(claim interface{}, config *Config) uint {
+	var values []string
+	switch v := claim.(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for i := range v {
+			if s, ok := v[i].(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	for _, claimRole := range oidcConf.ClaimRoles {
+		for _, value := range values {
+			if claimRole.Value == value {
+				return claimRole.Role
+			}
+		}
+	}
+
+	return config.Server.Roles.DefaultRole
+}
+
+// StartOIDCLogin creates a pending login and returns the URL of the
+// provider to redirect the user to and the state of the login. The
+// state has to be bound to the browser to prevent login CSRF
+func StartOIDCLogin(ctx context.Context, db *gorm.DB, config *Config, machineID string) (authURL, stateValue string, err error) {
+	ctx = oidc.ClientContext(ctx, oidcHTTPClient)
+
+	client, err := config.Server.OIDC.client(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(client.oauth.RedirectURL) == 0 {
+		return "", "", ErrorOIDCDisabled
+	}
+
+	// Remove abandoned logins
+	if err = db.Where("created_at < ?", time.Now().Add(-OIDCStateLifetime)).Delete(&OIDCState{}).Error; err != nil {
+		return "", "", err
+	}
+
+	state := OIDCState{MachineID: machineID}
+	for _, value := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		if *value, err = randomURLString(); err != nil {
+			return "", "", err
+		}
+	}
+
+	if err = db.Create(&state).Error; err != nil {
+		return "", "", err
+	}
+
+	// Use PKCE with S256
+	challenge := sha256.Sum256([]byte(state.Verifier))
+
+	authURL = client.oauth.AuthCodeURL(state.State,
+		oidc.Nonce(state.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+
+	return authURL, state.State, nil
+}
+
+// FinishOIDCLogin exchanges the code of a callback and
+// creates a session for the user of the ID token
+func FinishOIDCLogin(ctx context.Context, db *gorm.DB, config *Config, stateValue, code, ip string) (*User, *LoginSession, error) {
+	ctx = oidc.ClientContext(ctx, oidcHTTPClient)
+
+	client, err := config.Server.OIDC.client(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Each state can only be used once
+	var state OIDCState
+	if err = db.Where(&OIDCState{State: stateValue}).First(&state).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, ErrorOIDCInvalidState
+		}
+
+		return nil, nil, err
+	}
+
+	res := db.Delete(&state)
+	if res.Error != nil {
+		return nil, nil, res.Error
+	}
+	if res.RowsAffected == 0 || time.Since(state.CreatedAt) > OIDCStateLifetime {
+		return nil, nil, ErrorOIDCInvalidState
+	}
+
+	token, err := client.oauth.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", state.Verifier))
+	if err != nil {
+		if _, ok := err.(*oauth2.RetrieveError); ok {
+			log.Warn("OIDC code exchange failed: ", err)
+			return nil, nil, ErrorOIDCDenied
+		}
+
+		return nil, nil, err
+	}
+
+	idToken, err := client.verifyIDToken(ctx, token.Extra("id_token"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if idToken.Nonce != state.Nonce {
+		return nil, nil, ErrorInvalidCredentials
+	}
+
+	return loginOIDC(db, config, idToken, state.MachineID, ip)
+}
+
+// StartOIDCDeviceLogin starts a device authorization at the provider
+func StartOIDCDeviceLogin(ctx context.Context, config *Config) (*OIDCDeviceAuthorization, error) {
+	ctx = oidc.ClientContext(ctx, oidcHTTPClient)
+
+	client, err := config.Server.OIDC.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(client.deviceAuthURL) == 0 {
+		return nil, ErrorOIDCDisabled
+	}
+
+	var authorization OIDCDeviceAuthorization
+	err = client.post(ctx, client.deviceAuthURL, url.Values{
+		"scope": {strings.Join(client.oauth.Scopes, " ")},
+	}, &authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	// The default interval is 5 seconds
+	if authorization.Interval == 0 {
+		authorization.Interval = 5
+	}
+
+	return &authorization, nil
+}
+
+// PollOIDCDeviceLogin creates a session once the user
+// completed the device authorization at the provider
+func PollOIDCDeviceLogin(ctx context.Context, db *gorm.DB, config *Config, deviceCode, machineID, ip string) (*User, *LoginSession, error) {
+	ctx = oidc.ClientContext(ctx, oidcHTTPClient)
+
+	client, err := config.Server.OIDC.client(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(client.deviceAuthURL) == 0 {
+		return nil, nil, ErrorOIDCDisabled
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	err = client.post(ctx, client.oauth.Endpoint.TokenURL, url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {deviceCode},
+	}, &token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	idToken, err := client.verifyIDToken(ctx, token.IDToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return loginOIDC(db, config, idToken, machineID, ip)
+}
+
+// Verify the raw ID token returned by the token endpoint
+func (client *oidcClient) verifyIDToken(ctx context.Context, rawToken interface{}) (*oidc.IDToken, error) {
+	raw, ok := rawToken.(string)
+	if !ok || len(raw) == 0 {
+		return nil, errors.New("no ID token returned by the provider")
+	}
+
+	idToken, err := client.verifier.Verify(ctx, raw)
+	if err != nil {
+		log.Warn("Invalid OIDC ID token: ", err)
+		return nil, ErrorInvalidCredentials
+	}
+
+	return idToken, nil
+}
+
+// Send an authenticated form request to an endpoint of the provider
+// and decode its response into v. OAuth errors are converted
+func (client *oidcClient) post(ctx context.Context, endpoint string, values url.Values, v interface{}) error {
+	values.Set("client_id", client.oauth.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(client.oauth.ClientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(client.oauth.ClientID), url.QueryEscape(client.oauth.ClientSecret))
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		_ = json.Unmarshal(body, &oauthErr)
+
+		switch oauthErr.Error {
+		case "authorization_pending":
+			return ErrorOIDCPending
+		case "slow_down":
+			return ErrorOIDCSlowDown
+		case "access_denied", "expired_token", "invalid_grant":
+			return ErrorOIDCDenied
+		}
+
+		return fmt.Errorf("OIDC provider returned %d: %s %s", resp.StatusCode, oauthErr.Error, oauthErr.Description)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// Find or provision the user of a verified ID token and create a session.
+// Users are bound to the subject of the token to prevent takeovers
+func loginOIDC(db *gorm.DB, config *Config, idToken *oidc.IDToken, machineID, ip string) (*User, *LoginSession, error) {
+	oidcConf := config.Server.OIDC
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, nil, err
+	}
+
+	username, _ := claims[oidcConf.UsernameClaim].(string)
+	if len(username) == 0 {
+		return nil, nil, ErrorOIDCMissingClaim
+	}
+
+	role, err := FindRole(db, oidcConf.roleForClaim(claims[oidcConf.RoleClaim], config))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user := User{Username: username}
+	has, err := user.Has(db)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, nil, err
+	}
+
+	if has {
+		if user.AuthSource != AuthSourceOIDC || user.ExternalID != idToken.Subject {
+			return nil, nil, ErrorUserAlreadyExists
+		}
+
+		if err = user.syncRole(db, role); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		user = User{
+			Username:   username,
+			ExternalID: idToken.Subject,
+		}
+
+		if err = user.provision(db, AuthSourceOIDC, role); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if user.Disabled {
+		return nil, nil, ErrorUserDisabled
+	}
+
+	if err = user.CheckExternalSecondFactor(oidcConf.TrustExternal2FA); err != nil {
+		return nil, nil, err
+	}
+
+	session, err := user.createSession(db, machineID, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, session, nil
+}
+
+// Generate a random URL safe string
+func randomURLString() (string, error) {
+	buff := make([]byte, 32)
+	if _, err := rand.Read(buff); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buff), nil
+}
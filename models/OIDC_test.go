@@ -0,0 +1,381 @@
+package models
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Claims returned for a code of the mock provider
+type mockOIDCGrant struct {
+	Subject   string
+	Username  string
+	Groups    []string
+	Nonce     string
+	Challenge string
+}
+
+// Mock OIDC provider supporting discovery, JWKS, the authorization
+// code flow with PKCE and the device flow. Logins are authorized
+// by the tests using authorize and approveDevice
+type mockOIDCProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mx      sync.Mutex
+	codes   map[string]mockOIDCGrant
+	devices map[string]*mockOIDCGrant
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &mockOIDCProvider{
+		key:     key,
+		codes:   make(map[string]mockOIDCGrant),
+		devices: make(map[string]*mockOIDCGrant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.discovery)
+	mux.HandleFunc("/jwks", provider.jwks)
+	mux.HandleFunc("/token", provider.token)
+	mux.HandleFunc("/device", provider.device)
+
+	provider.Server = httptest.NewServer(mux)
+	t.Cleanup(provider.Close)
+
+	return provider
+}
+
+func (provider *mockOIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                provider.URL,
+		"authorization_endpoint":                provider.URL + "/authorize",
+		"token_endpoint":                        provider.URL + "/token",
+		"device_authorization_endpoint":         provider.URL + "/device",
+		"jwks_uri":                              provider.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (provider *mockOIDCProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(provider.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(provider.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (provider *mockOIDCProvider) device(w http.ResponseWriter, r *http.Request) {
+	provider.mx.Lock()
+	defer provider.mx.Unlock()
+
+	deviceCode := "device" + r.FormValue("client_id")
+	provider.devices[deviceCode] = nil
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"device_code":      deviceCode,
+		"user_code":        "ABCD-EFGH",
+		"verification_uri": provider.URL + "/activate",
+		"expires_in":       600,
+	})
+}
+
+func (provider *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	provider.mx.Lock()
+	defer provider.mx.Unlock()
+
+	if clientID, secret, ok := r.BasicAuth(); !ok || clientID != "dm" || secret != "secret" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	var grant mockOIDCGrant
+
+	switch r.FormValue("grant_type") {
+	case "authorization_code":
+		var ok bool
+		if grant, ok = provider.codes[r.FormValue("code")]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		delete(provider.codes, r.FormValue("code"))
+
+		// Verify PKCE
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.Challenge {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		approved, ok := provider.devices[r.FormValue("device_code")]
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expired_token"})
+			return
+		}
+
+		if approved == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "authorization_pending"})
+			return
+		}
+
+		grant = *approved
+		delete(provider.devices, r.FormValue("device_code"))
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     provider.idToken(grant),
+	})
+}
+
+// Create a signed ID token for grant
+func (provider *mockOIDCProvider) idToken(grant mockOIDCGrant) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":                provider.URL,
+		"sub":                grant.Subject,
+		"aud":                "dm",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              grant.Nonce,
+		"preferred_username": grant.Username,
+		"groups":             grant.Groups,
+	})
+
+	payload := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(payload))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, provider.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Let the user of grant login with the authorization URL
+// returned by StartOIDCLogin. Returns the code for the callback
+func (provider *mockOIDCProvider) authorize(t *testing.T, authURL string, grant mockOIDCGrant) string {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || len(query.Get("code_challenge")) == 0 {
+		t.Fatalf("login doesn't use PKCE: %s", authURL)
+	}
+
+	grant.Challenge = query.Get("code_challenge")
+	if len(grant.Nonce) == 0 {
+		grant.Nonce = query.Get("nonce")
+	}
+
+	provider.mx.Lock()
+	defer provider.mx.Unlock()
+
+	code := "code" + grant.Subject + grant.Nonce
+	provider.codes[code] = grant
+	return code
+}
+
+// Complete the device login of deviceCode as the user of grant
+func (provider *mockOIDCProvider) approveDevice(deviceCode string, grant mockOIDCGrant) {
+	provider.mx.Lock()
+	defer provider.mx.Unlock()
+
+	provider.devices[deviceCode] = &grant
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Config using provider with members of the group
+// admins getting the admin role
+func newOIDCTestConfig(provider *mockOIDCProvider) *Config {
+	config := &Config{}
+	config.Server.OIDC = oidcConfig{
+		Enabled:       true,
+		Issuer:        provider.URL,
+		ClientID:      "dm",
+		ClientSecret:  "secret",
+		RedirectURL:   "http://localhost/oidc/callback",
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+		ClaimRoles: []oidcClaimRole{
+			{Value: "admins", Role: 2},
+		},
+	}
+
+	return config
+}
+
+func TestOIDCCodeFlow(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	config := newOIDCTestConfig(provider)
+	db := newTestDB(t, config)
+	ctx := context.Background()
+
+	authURL, state, err := StartOIDCLogin(ctx, db, config, "machine")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := provider.authorize(t, authURL, mockOIDCGrant{
+		Subject:  "sub-alice",
+		Username: "alice",
+		Groups:   []string{"staff", "admins"},
+	})
+
+	user, session, err := FinishOIDCLogin(ctx, db, config, state, code, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.AuthSource != AuthSourceOIDC || user.ExternalID != "sub-alice" || user.RoleID != 2 {
+		t.Errorf("alice provisioned from '%s' as '%s' with role %d", user.AuthSource, user.ExternalID, user.RoleID)
+	}
+
+	if session == nil || len(session.Token) == 0 || session.MachineID != "machine" {
+		t.Errorf("invalid session %+v", session)
+	}
+
+	// States can only be used once
+	if _, _, err = FinishOIDCLogin(ctx, db, config, state, code, "127.0.0.1"); err != ErrorOIDCInvalidState {
+		t.Errorf("reused state got %v", err)
+	}
+
+	// Unknown states are rejected before exchanging the code
+	if _, _, err = FinishOIDCLogin(ctx, db, config, "unknown", code, "127.0.0.1"); err != ErrorOIDCInvalidState {
+		t.Errorf("unknown state got %v", err)
+	}
+}
+
+func TestOIDCCodeFlowRejectsInvalidTokens(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	config := newOIDCTestConfig(provider)
+	db := newTestDB(t, config)
+	ctx := context.Background()
+
+	// ID tokens of other logins have a different nonce
+	authURL, state, err := StartOIDCLogin(ctx, db, config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := provider.authorize(t, authURL, mockOIDCGrant{Subject: "sub-eve", Username: "eve", Nonce: "other"})
+	if _, _, err = FinishOIDCLogin(ctx, db, config, state, code, ""); err != ErrorInvalidCredentials {
+		t.Errorf("wrong nonce got %v", err)
+	}
+
+	// Local users can't be taken over
+	if err = db.Create(&User{Username: "bob", RoleID: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if authURL, state, err = StartOIDCLogin(ctx, db, config, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	code = provider.authorize(t, authURL, mockOIDCGrant{Subject: "sub-bob", Username: "bob"})
+	if _, _, err = FinishOIDCLogin(ctx, db, config, state, code, ""); err != ErrorUserAlreadyExists {
+		t.Errorf("takeover of a local user got %v", err)
+	}
+}
+
+func TestOIDCDeviceFlow(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	config := newOIDCTestConfig(provider)
+	db := newTestDB(t, config)
+	ctx := context.Background()
+
+	authorization, err := StartOIDCDeviceLogin(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(authorization.DeviceCode) == 0 || authorization.Interval != 5 {
+		t.Fatalf("invalid device authorization %+v", authorization)
+	}
+
+	if _, _, err = PollOIDCDeviceLogin(ctx, db, config, authorization.DeviceCode, "", ""); err != ErrorOIDCPending {
+		t.Fatalf("pending login got %v", err)
+	}
+
+	provider.approveDevice(authorization.DeviceCode, mockOIDCGrant{Subject: "sub-carol", Username: "carol"})
+
+	user, session, err := PollOIDCDeviceLogin(ctx, db, config, authorization.DeviceCode, "cli", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Username != "carol" || user.RoleID != 1 || session.MachineID != "cli" {
+		t.Errorf("carol logged in with role %d and machine '%s'", user.RoleID, session.MachineID)
+	}
+
+	// Device codes can only be used once
+	if _, _, err = PollOIDCDeviceLogin(ctx, db, config, authorization.DeviceCode, "", ""); err != ErrorOIDCDenied {
+		t.Errorf("reused device code got %v", err)
+	}
+}
+
+func TestOIDCRequire2FA(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	config := newOIDCTestConfig(provider)
+	db := newTestDB(t, config)
+	ctx := context.Background()
+
+	if err := db.Model(&Role{}).Where("id = ?", 2).Update("require2fa", true).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	login := func() error {
+		authURL, state, err := StartOIDCLogin(ctx, db, config, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code := provider.authorize(t, authURL, mockOIDCGrant{Subject: "sub-alice", Username: "alice", Groups: []string{"admins"}})
+		_, _, err = FinishOIDCLogin(ctx, db, config, state, code, "")
+		return err
+	}
+
+	// The provider isn't trusted to check a second factor by default
+	if err := login(); err != ErrorExternalSecondFactor {
+		t.Errorf("login of a role requiring 2FA got %v", err)
+	}
+
+	config.Server.OIDC.TrustExternal2FA = true
+	if err := login(); err != nil {
+		t.Errorf("login trusting the providers 2FA got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/JojiiOfficial/gaw"
+	"golang.org/x/crypto/argon2"
+	"gorm.io/gorm"
+)
+
+// Prefix of argon2id encoded password hashes
+const argon2idPrefix = "$argon2id$"
+
+// ErrorInvalidPasswordHash error if a stored hash can't be parsed
+var ErrorInvalidPasswordHash = errors.New("invalid password hash")
+
+// argon2Params parameters used to derive an argon2id key
+type argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Get the argon2 parameters from the config
+func (config hashingConfig) params() argon2Params {
+	return argon2Params{
+		Memory:      config.Memory,
+		Iterations:  config.Iterations,
+		Parallelism: config.Parallelism,
+		SaltLength:  config.SaltLength,
+		KeyLength:   config.KeyLength,
+	}
+}
+
+// HashPassword hashes a password using argon2id
+// and a random salt. The returned string contains
+// all parameters required to verify the password
+func HashPassword(password string, config *Config) (string, error) {
+	params := config.Server.PasswordHashing.params()
+
+	// Generate salt
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Parse an argon2id encoded hash
+func decodeArgon2Hash(encoded string) (*argon2Params, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, nil, nil, ErrorInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, ErrorInvalidPasswordHash
+	}
+
+	var params argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, ErrorInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrorInvalidPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, ErrorInvalidPasswordHash
+	}
+
+	// Zero parameters would make argon2 panic and an
+	// empty key would match any password
+	if params.Iterations < 1 || params.Parallelism < 1 || len(salt) == 0 || len(key) == 0 {
+		return nil, nil, nil, ErrorInvalidPasswordHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return &params, salt, key, nil
+}
+
+// IsLegacyPasswordHash returns true if hash was
+// created using the old unsalted SHA512 method
+func IsLegacyPasswordHash(hash string) bool {
+	return !strings.HasPrefix(hash, argon2idPrefix)
+}
+
+// CheckPassword compares password with the users stored hash in
+// constant time. needsRehash is true if the password is valid but
+// was hashed using a legacy method or outdated parameters
+func (user *User) CheckPassword(password string, config *Config) (valid, needsRehash bool) {
+	// Verify legacy SHA512 hashes
+	if IsLegacyPasswordHash(user.Password) {
+		legacyHash := gaw.SHA512(user.GetUsername() + password)
+		return subtle.ConstantTimeCompare([]byte(legacyHash), []byte(user.Password)) == 1, true
+	}
+
+	params, salt, key, err := decodeArgon2Hash(user.Password)
+	if err != nil {
+		return false, false
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false
+	}
+
+	return true, *params != config.Server.PasswordHashing.params()
+}
+
+// SetPassword hashes and sets the password of user
+// without saving it
+func (user *User) SetPassword(password string, config *Config) error {
+	hash, err := HashPassword(password, config)
+	if err != nil {
+		return err
+	}
+
+	user.Password = hash
+	return nil
+}
+
+// UpdatePassword hashes and saves the new password of user
+func (user *User) UpdatePassword(db *gorm.DB, password string, config *Config) error {
+	if user.IsExternal() {
+		return ErrorExternalUser
+	}
+
+	if err := user.SetPassword(password, config); err != nil {
+		return err
+	}
+
+	return db.Model(user).Update("password", user.Password).Error
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JojiiOfficial/gaw"
+)
+
+// Returns a config with cheap hashing parameters
+func newPasswordConfig() *Config {
+	config := &Config{}
+	config.Server.PasswordHashing = hashingConfig{
+		Memory:      64,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  8,
+		KeyLength:   16,
+	}
+
+	return config
+}
+
+func TestCheckPasswordMalformed(t *testing.T) {
+	config := newPasswordConfig()
+
+	valid, err := HashPassword("secret", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(valid, "$")
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"prefix only", argon2idPrefix},
+		{"truncated", valid[:len(valid)/2]},
+		{"missing key", strings.Join(parts[:5], "$")},
+		{"extra part", valid + "$AAAA"},
+		{"wrong version", "$argon2id$v=16$" + strings.Join(parts[3:], "$")},
+		{"no version", "$argon2id$$" + strings.Join(parts[3:], "$")},
+		{"bad params", "$argon2id$v=19$m=x,t=1,p=1$" + strings.Join(parts[4:], "$")},
+		{"zero iterations", "$argon2id$v=19$m=64,t=0,p=1$" + strings.Join(parts[4:], "$")},
+		{"zero parallelism", "$argon2id$v=19$m=64,t=1,p=0$" + strings.Join(parts[4:], "$")},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!!$" + parts[5]},
+		{"bad key", "$argon2id$v=19$m=64,t=1,p=1$" + parts[4] + "$!!!"},
+		{"empty salt", "$argon2id$v=19$m=64,t=1,p=1$$" + parts[5]},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$" + parts[4] + "$"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, _, err := decodeArgon2Hash(test.hash); err != ErrorInvalidPasswordHash {
+				t.Errorf("expected %v, got %v", ErrorInvalidPasswordHash, err)
+			}
+
+			user := User{Username: "user", Password: test.hash}
+			if ok, rehash := user.CheckPassword("secret", config); ok || rehash {
+				t.Errorf("malformed hash accepted: valid %v, needsRehash %v", ok, rehash)
+			}
+		})
+	}
+}
+
+func TestAuthenticatePassword(t *testing.T) {
+	config := newPasswordConfig()
+	db := newTestDB(t, config)
+
+	current, err := HashPassword("secret", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outdatedConfig := newPasswordConfig()
+	outdatedConfig.Server.PasswordHashing.Iterations = 2
+	outdated, err := HashPassword("secret", outdatedConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		err      error
+		upgraded bool
+	}{
+		{"argon2id", current, "secret", nil, false},
+		{"argon2id wrong password", current, "wrong", ErrorInvalidCredentials, false},
+		{"outdated parameters", outdated, "secret", nil, true},
+		{"legacy", gaw.SHA512("user" + "secret"), "secret", nil, true},
+		{"legacy wrong password", gaw.SHA512("user" + "secret"), "wrong", ErrorInvalidCredentials, false},
+		{"legacy other username", gaw.SHA512("other" + "secret"), "secret", ErrorInvalidCredentials, false},
+		{"empty password", current, "", ErrorInvalidCredentials, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stored := User{Username: "user", Password: test.hash, RoleID: 1}
+			if err := db.Create(&stored).Error; err != nil {
+				t.Fatal(err)
+			}
+			defer db.Unscoped().Delete(&stored)
+
+			user := User{Username: "user", Password: test.password}
+			if err := user.Authenticate(db, config); err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+
+			if err := db.First(&stored, stored.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if upgraded := stored.Password != test.hash; upgraded != test.upgraded {
+				t.Fatalf("expected upgraded %v, got %v", test.upgraded, upgraded)
+			}
+
+			if test.upgraded {
+				if IsLegacyPasswordHash(stored.Password) {
+					t.Fatal("upgraded hash is still legacy")
+				}
+
+				if ok, rehash := stored.CheckPassword(test.password, config); !ok || rehash {
+					t.Errorf("upgraded hash: valid %v, needsRehash %v", ok, rehash)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Permission a set of permissions granted to a role
+type Permission uint32
+
+// Permissions which can be granted to roles
+const (
+	PermissionUploadFiles Permission = 1 << iota
+	PermissionUploadURLs
+	PermissionPublish
+	PermissionEditFiles
+	PermissionDeleteFiles
+	PermissionManageAttributes
+	PermissionCreateNamespaces
+	PermissionReadForeignNamespaces
+	PermissionWriteForeignNamespaces
+	PermissionAdmin
+	PermissionCreateInvites
+
+	// NoPermission grants nothing
+	NoPermission Permission = 0
+)
+
+// PermissionAll name to grant all permissions
+const PermissionAll = "all"
+
+// Names of the permissions used in
+// the config, the API and the CLI
+var permissionNames = []struct {
+	permission Permission
+	name       string
+}{
+	{PermissionUploadFiles, "uploadFiles"},
+	{PermissionUploadURLs, "uploadURLs"},
+	{PermissionPublish, "publish"},
+	{PermissionEditFiles, "editFiles"},
+	{PermissionDeleteFiles, "deleteFiles"},
+	{PermissionManageAttributes, "manageAttributes"},
+	{PermissionCreateNamespaces, "createNamespaces"},
+	{PermissionReadForeignNamespaces, "readForeignNamespaces"},
+	{PermissionWriteForeignNamespaces, "writeForeignNamespaces"},
+	{PermissionAdmin, "admin"},
+	{PermissionCreateInvites, "createInvites"},
+}
+
+// AllPermissions returns a permission containing all permissions
+func AllPermissions() Permission {
+	var all Permission
+	for _, p := range permissionNames {
+		all |= p.permission
+	}
+
+	return all
+}
+
+// PermissionNames returns the names of all permissions
+func PermissionNames() []string {
+	names := make([]string, len(permissionNames))
+	for i, p := range permissionNames {
+		names[i] = p.name
+	}
+
+	return names
+}
+
+// ParsePermissions parses a list of permission names
+func ParsePermissions(names []string) (Permission, error) {
+	var permission Permission
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+
+		if strings.EqualFold(name, PermissionAll) {
+			permission |= AllPermissions()
+			continue
+		}
+
+		found := false
+		for _, p := range permissionNames {
+			if strings.EqualFold(p.name, name) {
+				permission |= p.permission
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return NoPermission, fmt.Errorf("unknown permission '%s'", name)
+		}
+	}
+
+	return permission, nil
+}
+
+// Has returns true if all given permissions are granted
+func (permission Permission) Has(required Permission) bool {
+	return permission&required == required
+}
+
+// Names returns the names of all granted permissions
+func (permission Permission) Names() []string {
+	names := []string{}
+	for _, p := range permissionNames {
+		if permission.Has(p.permission) {
+			names = append(names, p.name)
+		}
+	}
+
+	return names
+}
+
+func (permission Permission) String() string {
+	return strings.Join(permission.Names(), ",")
+}
+
+// MarshalJSON encodes the permission as list of names
+func (permission Permission) MarshalJSON() ([]byte, error) {
+	return json.Marshal(permission.Names())
+}
+
+// UnmarshalJSON decodes a list of permission names
+func (permission *Permission) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+
+	p, err := ParsePermissions(names)
+	if err != nil {
+		return err
+	}
+
+	*permission = p
+	return nil
+}
+
+// MarshalYAML encodes the permission as list of names
+func (permission Permission) MarshalYAML() (interface{}, error) {
+	return permission.Names(), nil
+}
+
+// UnmarshalYAML decodes a list of permission names
+func (permission *Permission) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var names []string
+	if err := unmarshal(&names); err != nil {
+		return err
+	}
+
+	p, err := ParsePermissions(names)
+	if err != nil {
+		return err
+	}
+
+	*permission = p
+	return nil
+}
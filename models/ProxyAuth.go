@@ -0,0 +1,40 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// AuthSourceProxy auth source of users created by proxy authentication
+const AuthSourceProxy = "proxy"
+
+// GetProxyUser returns the user a trusted reverse proxy authenticated.
+// Unknown users are created with the default role if enabled
+func GetProxyUser(db *gorm.DB, config *Config, username string) (*User, error) {
+	user := User{Username: username}
+	has, err := user.Has(db)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	if !has {
+		if !config.Server.ProxyAuth.AutoCreate {
+			return nil, err
+		}
+
+		role, err := FindRole(db, config.Server.Roles.DefaultRole)
+		if err != nil {
+			return nil, err
+		}
+
+		user = User{Username: username}
+		if err = user.provision(db, AuthSourceProxy, role); err != nil {
+			return nil, err
+		}
+	}
+
+	if user.Disabled {
+		return nil, ErrorUserDisabled
+	}
+
+	return &user, nil
+}
@@ -1,52 +1,236 @@
 package models
 
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
 // Role roles for user
 type Role struct {
-	ID                     uint       `gorm:"pk"`
-	RoleName               string     `gorm:"not null"`
-	IsAdmin                bool       `gorm:"default:false"`
-	AccesForeignNamespaces Permission `gorm:"type:smallint"`
-	MaxURLcontentSize      int64
-	MaxUploadFileSize      int64
-	CreateNamespaces       bool
-}
-
-// Permission permission for roles
-type Permission uint8
-
-// Permissions
-const (
-	NoPermission Permission = iota
-	ReadPermission
-	Writepermission
+	ID                uint       `gorm:"pk"`
+	RoleName          string     `gorm:"not null"`
+	Permissions       Permission `gorm:"not null;default:0"`
+	MaxURLcontentSize int64
+	MaxUploadFileSize int64
+	Require2FA        bool `gorm:"column:require2fa;default:false"`
+}
+
+var (
+	// ErrorRoleNotFound error if a role doesn't exist
+	ErrorRoleNotFound = errors.New("role not found")
+
+	// ErrorRoleInUse error if a role which is still assigned to users should be deleted
+	ErrorRoleInUse = errors.New("role is assigned to users")
+
+	// ErrorDefaultRole error if the default role should be deleted
+	ErrorDefaultRole = errors.New("role is the default role")
+
+	// ErrorInvalidRole error if a role has invalid values
+	ErrorInvalidRole = errors.New("invalid role")
+
+	// ErrorLastAdmin error if a change would leave no enabled admin
+	ErrorLastAdmin = errors.New("no enabled user would be admin")
 )
 
+// FindRole finds a role by its ID
+func FindRole(db *gorm.DB, id uint) (*Role, error) {
+	var role Role
+	if err := db.First(&role, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrorRoleNotFound
+		}
+
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+// NewRole returns a role without
+// permissions and size limits
+func NewRole(name string) Role {
+	return Role{
+		RoleName:          name,
+		MaxURLcontentSize: -1,
+		MaxUploadFileSize: -1,
+	}
+}
+
+// GetAllRoles returns all roles
+func GetAllRoles(db *gorm.DB) ([]Role, error) {
+	var roles []Role
+	return roles, db.Order("id").Find(&roles).Error
+}
+
+// GetDefaultRole returns the role assigned to new users
+func GetDefaultRole(db *gorm.DB, config *Config) (*Role, error) {
+	return FindRole(db, config.Server.Roles.DefaultRole)
+}
+
+// Validate returns ErrorInvalidRole if the role can't be used
+func (role *Role) Validate(config *Config) error {
+	if len(role.RoleName) == 0 ||
+		role.Permissions&^AllPermissions() != 0 ||
+		role.MaxUploadFileSize > config.Webserver.MaxUploadFileLength {
+		return ErrorInvalidRole
+	}
+
+	return nil
+}
+
+// Create creates a new role with the next free ID
+func (role *Role) Create(db *gorm.DB) error {
+	role.ID = 0
+	return db.Create(role).Error
+}
+
+// SyncRoleSequence advances the postgres ID sequence past
+// the seeded roles since they are created with fixed IDs
+func SyncRoleSequence(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	return db.Exec("SELECT setval(pg_get_serial_sequence('roles', 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM roles), false)").Error
+}
+
+// Save stores all values of the role and reloads cached sessions of users
+// with this role. Returns ErrorLastAdmin if no enabled admin would be left
+func (role *Role) Save(db *gorm.DB) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !role.Permissions.Has(PermissionAdmin) {
+			if err := checkLastAdmin(tx, role.ID, 0); err != nil {
+				return err
+			}
+		}
+
+		return tx.Save(role).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	sessionCache.invalidateRole(role.ID)
+	return nil
+}
+
+// Returns ErrorLastAdmin if there is an enabled admin but none would
+// be left without the users having excludeRole and the user excludeUser
+func checkLastAdmin(db *gorm.DB, excludeRole, excludeUser uint) error {
+	before, err := countEnabledAdmins(db, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	after, err := countEnabledAdmins(db, excludeRole, excludeUser)
+	if err != nil {
+		return err
+	}
+
+	if before > 0 && after == 0 {
+		return ErrorLastAdmin
+	}
+
+	return nil
+}
+
+// Returns the count of enabled users with a role granting admin permissions.
+// Users with the role excludeRole and the user excludeUser are ignored
+func countEnabledAdmins(db *gorm.DB, excludeRole, excludeUser uint) (int64, error) {
+	var count int64
+
+	err := db.Model(&User{}).
+		Joins("INNER JOIN roles ON roles.id = users.role_id").
+		Where("users.disabled = ? AND roles.permissions & ? <> 0 AND roles.id <> ? AND users.id <> ?", false, PermissionAdmin, excludeRole, excludeUser).
+		Count(&count).Error
+
+	return count, err
+}
+
+// Delete deletes the role if it's neither
+// the default role nor assigned to a user
+func (role *Role) Delete(db *gorm.DB, config *Config) error {
+	if role.ID == config.Server.Roles.DefaultRole {
+		return ErrorDefaultRole
+	}
+
+	count, err := role.GetUserCount(db)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return ErrorRoleInUse
+	}
+
+	// Invites would register users with a missing role
+	if err = db.Model(&Invite{}).Where(&Invite{RoleID: role.ID}).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return ErrorRoleInUse
+	}
+
+	return db.Delete(role).Error
+}
+
+// GetUserCount returns the count of users with the role
+func (role *Role) GetUserCount(db *gorm.DB) (int64, error) {
+	var c int64
+	return c, db.Model(&User{}).Where(&User{RoleID: role.ID}).Count(&c).Error
+}
+
+// HasPermission returns true if the users role grants permission
+func (user User) HasPermission(permission Permission) bool {
+	return user.Role != nil && user.Role.Permissions.Has(permission)
+}
+
 // HasUploadLimit gets upload limit
 func (user User) HasUploadLimit() bool {
 	return user.Role.MaxURLcontentSize > -1
 }
 
-// AllowedToUploadURLs gets upload limit
+// AllowedToUploadURLs return true if user can upload files from URLs
 func (user User) AllowedToUploadURLs() bool {
-	return user.Role.MaxURLcontentSize != 0
+	return user.HasPermission(PermissionUploadURLs)
 }
 
 // CanUploadFiles return true if user can upload files
 func (user User) CanUploadFiles() bool {
-	return user.Role.MaxUploadFileSize != 0
+	return user.HasPermission(PermissionUploadFiles)
 }
 
 // CanWriteForeignNamespace return true if user is allowed to write in foreign namespaces
 func (user User) CanWriteForeignNamespace() bool {
-	return user.Role.AccesForeignNamespaces&Writepermission == Writepermission
+	return user.HasPermission(PermissionWriteForeignNamespaces)
 }
 
-// CanReadForeignNamespace return true if user is allowed to read in foreign namespaces
+// CanReadForeignNamespace return true if user is allowed to read in foreign namespaces.
+// Write access to foreign namespaces implies read access
 func (user User) CanReadForeignNamespace() bool {
-	return user.Role.AccesForeignNamespaces&ReadPermission == ReadPermission
+	return user.HasPermission(PermissionReadForeignNamespaces) || user.CanWriteForeignNamespace()
+}
+
+// IsAdmin return true if user has an admin role
+func (user User) IsAdmin() bool {
+	return user.HasPermission(PermissionAdmin)
+}
+
+// CanCreateInvites return true if user can invite other users
+func (user User) CanCreateInvites() bool {
+	return user.IsAdmin() || user.HasPermission(PermissionCreateInvites)
+}
+
+// CanAssignRole return true if user is allowed to assign role to other
+// users. Only admins can grant permissions they don't have themselves
+func (user User) CanAssignRole(role *Role) bool {
+	return user.IsAdmin() || (user.Role != nil && role.Permissions&^user.Role.Permissions == 0)
 }
 
 // CanCreateNamespaces return true if user can create user namespaces
 func (user User) CanCreateNamespaces() bool {
-	return user.Role.CreateNamespaces
+	return user.HasPermission(PermissionCreateNamespaces)
 }
@@ -0,0 +1,49 @@
+package models
+
+import "testing"
+
+func TestLastAdmin(t *testing.T) {
+	db := newTestDB(t, &Config{})
+
+	admin := User{Username: "admin", RoleID: 2}
+	if err := db.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	userRole := &Role{ID: 1, Permissions: PermissionUploadFiles}
+	adminRole := &Role{ID: 2, Permissions: PermissionUploadFiles}
+
+	if err := admin.SetRole(db, userRole); err != ErrorLastAdmin {
+		t.Errorf("SetRole of last admin: expected %v, got %v", ErrorLastAdmin, err)
+	}
+	if err := admin.SetDisabled(db, true); err != ErrorLastAdmin {
+		t.Errorf("SetDisabled of last admin: expected %v, got %v", ErrorLastAdmin, err)
+	}
+	if err := adminRole.Save(db); err != ErrorLastAdmin {
+		t.Errorf("Save of last admin role: expected %v, got %v", ErrorLastAdmin, err)
+	}
+	if err := admin.Delete(db, &Config{}); err != ErrorLastAdmin {
+		t.Errorf("Delete of last admin: expected %v, got %v", ErrorLastAdmin, err)
+	}
+
+	var stored User
+	if err := db.First(&stored, admin.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.RoleID != 2 || stored.Disabled {
+		t.Fatalf("last admin was changed: role %d, disabled %v", stored.RoleID, stored.Disabled)
+	}
+
+	// With a second enabled admin the first one may be demoted
+	second := User{Username: "second", RoleID: 2}
+	if err := db.Create(&second).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := admin.SetRole(db, userRole); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.SetDisabled(db, true); err != ErrorLastAdmin {
+		t.Errorf("SetDisabled of remaining admin: expected %v, got %v", ErrorLastAdmin, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/DataManager-Go/DataManagerServer/metrics"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -49,6 +50,7 @@ func (sc *SessionCache) getSession(token string) *LoginSession {
 	// Get cache entry
 	session, ok := sc.cache[token]
 	if !ok {
+		metrics.SessionCacheLookups.WithLabelValues("miss").Inc()
 		return nil
 	}
 
@@ -59,16 +61,20 @@ func (sc *SessionCache) getSession(token string) *LoginSession {
 	// cache if invalid
 	if !session.valid {
 		delete(sc.cache, token)
+		metrics.SessionCacheLookups.WithLabelValues("miss").Inc()
 		return nil
 	}
 
 	// Update if neccessary
 	if session.needUpdate() {
 		if !session.update() {
+			metrics.SessionCacheLookups.WithLabelValues("miss").Inc()
 			return nil
 		}
 	}
 
+	metrics.SessionCacheLookups.WithLabelValues("hit").Inc()
+
 	return session.session
 }
 
@@ -87,6 +93,46 @@ func (sc *SessionCache) addSession(session *LoginSession, db *gorm.DB) {
 	}
 }
 
+// Remove a session from the cache
+func (sc *SessionCache) removeSession(token string) {
+	sc.init()
+
+	sc.mx.Lock()
+	defer sc.mx.Unlock()
+
+	delete(sc.cache, token)
+}
+
+// Remove all sessions of a user from the
+// cache to reload them on the next request
+func (sc *SessionCache) invalidateUser(userID uint) {
+	sc.init()
+
+	sc.mx.Lock()
+	defer sc.mx.Unlock()
+
+	for token, entry := range sc.cache {
+		if entry.session.UserID == userID {
+			delete(sc.cache, token)
+		}
+	}
+}
+
+// Remove all sessions of users with the given role
+// from the cache to reload them on the next request
+func (sc *SessionCache) invalidateRole(roleID uint) {
+	sc.init()
+
+	sc.mx.Lock()
+	defer sc.mx.Unlock()
+
+	for token, entry := range sc.cache {
+		if entry.session.User != nil && entry.session.User.RoleID == roleID {
+			delete(sc.cache, token)
+		}
+	}
+}
+
 func (sce *sessionCacheEntry) update() bool {
 	sce.mx.Lock()
 	defer sce.mx.Unlock()
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ShredJob a file being shredded. Jobs are stored until they
+// are done to resume them if the server stopped in between
+type ShredJob struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	LocalFile string
+	Size      int64
+}
+
+var (
+	// Running shred jobs
+	shredJobs sync.WaitGroup
+
+	// Set once the server waits for the running jobs.
+	// New jobs aren't started but resumed on the next start
+	shredClosing bool
+	shredMx      sync.Mutex
+)
+
+// StartShredJob shredders localFile in background. Pass
+// a negative size to use the current size of the file
+func StartShredJob(db *gorm.DB, localFile string, size int64) {
+	job := &ShredJob{
+		LocalFile: localFile,
+		Size:      size,
+	}
+
+	// Shredder the file even if the job can't be stored
+	if err := db.Create(job).Error; err != nil {
+		log.Error(err)
+	}
+
+	runShredJob(db, job)
+}
+
+// ResumeShredJobs restarts the jobs which weren't done before the last shutdown
+func ResumeShredJobs(db *gorm.DB) error {
+	var jobs []ShredJob
+	if err := db.Find(&jobs).Error; err != nil {
+		return err
+	}
+
+	if len(jobs) > 0 {
+		log.Infof("Resuming %d shred jobs", len(jobs))
+	}
+
+	for i := range jobs {
+		runShredJob(db, &jobs[i])
+	}
+
+	return nil
+}
+
+// WaitForShredJobs waits for running shred jobs until ctx is done.
+// Returns false if jobs are still running. Unfinished jobs and jobs
+// started after calling it are resumed on the next start
+func WaitForShredJobs(ctx context.Context) bool {
+	shredMx.Lock()
+	shredClosing = true
+	shredMx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		shredJobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func runShredJob(db *gorm.DB, job *ShredJob) {
+	shredMx.Lock()
+	defer shredMx.Unlock()
+
+	if shredClosing {
+		if job.ID == 0 {
+			log.Warnf("Can't shred '%s' while shutting down", job.LocalFile)
+		}
+
+		return
+	}
+
+	shredJobs.Add(1)
+
+	go func() {
+		defer shredJobs.Done()
+
+		ShredderFile(job.LocalFile, job.Size)
+
+		if job.ID > 0 {
+			if err := db.Delete(job).Error; err != nil {
+				log.Error(err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,294 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" // #nosec required by RFC 6238
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TOTP parameters. Most authenticator apps
+// only support these values
+const (
+	totpDigits     = 6
+	totpPeriod     = 30
+	totpSecretSize = 20
+	totpSkew       = 1
+
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	recoveryCodeChars  = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var (
+	// ErrorSecondFactorRequired error if the user has to provide a TOTP code
+	ErrorSecondFactorRequired = errors.New("second factor required")
+
+	// ErrorInvalidSecondFactor error if the TOTP or recovery code is invalid
+	ErrorInvalidSecondFactor = errors.New("invalid second factor")
+
+	// ErrorSecondFactorEnrollment error if the users role requires 2FA but the user hasn't enrolled yet
+	ErrorSecondFactorEnrollment = errors.New("two-factor enrollment required")
+
+	// ErrorNoTOTPEnrollment error if a TOTP secret should be confirmed but none was enrolled
+	ErrorNoTOTPEnrollment = errors.New("no pending two-factor enrollment")
+
+	// ErrorExternalSecondFactor error if a users role requires 2FA which
+	// a proxy, certificate or OIDC login isn't trusted to provide
+	ErrorExternalSecondFactor = errors.New("second factor of external login not trusted")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// RecoveryCode a one-time code to login without TOTP
+type RecoveryCode struct {
+	gorm.Model
+	UserID uint   `gorm:"index;not null"`
+	Hash   string `gorm:"not null"`
+}
+
+// HasTOTP returns true if the user has enabled TOTP
+func (user *User) HasTOTP() bool {
+	return user.TOTPEnabled && len(user.TOTPSecret) > 0
+}
+
+// RequiresTOTP returns true if the users role enforces 2FA
+func (user *User) RequiresTOTP() bool {
+	return user.Role != nil && user.Role.Require2FA
+}
+
+// CheckExternalSecondFactor returns ErrorExternalSecondFactor if the users
+// role requires 2FA and the source of an external login isn't trusted to
+// verify a second factor. External logins can't check the TOTP code
+func (user *User) CheckExternalSecondFactor(trusted bool) error {
+	if user.RequiresTOTP() && !trusted {
+		return ErrorExternalSecondFactor
+	}
+
+	return nil
+}
+
+// EnrollTOTP generates a new TOTP secret for the user. TOTP stays
+// disabled and existing recovery codes are kept until it's confirmed
+func (user *User) EnrollTOTP(db *gorm.DB) (string, error) {
+	rawSecret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(rawSecret); err != nil {
+		return "", err
+	}
+
+	secret := totpEncoding.EncodeToString(rawSecret)
+
+	// Keep an already enabled
+	// secret until confirmed
+	if user.HasTOTP() {
+		user.TOTPPendingSecret = secret
+	} else {
+		user.TOTPSecret = secret
+		user.TOTPEnabled = false
+	}
+
+	err := db.Model(user).Select("totp_secret", "totp_pending_secret", "totp_enabled").Updates(user).Error
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// ConfirmTOTP enables the enrolled secret if code is valid for it
+// and replaces the recovery codes of the user by new ones
+func (user *User) ConfirmTOTP(db *gorm.DB, code string) ([]string, error) {
+	secret := user.TOTPSecret
+	if len(user.TOTPPendingSecret) > 0 {
+		secret = user.TOTPPendingSecret
+	} else if user.TOTPEnabled || len(secret) == 0 {
+		return nil, ErrorNoTOTPEnrollment
+	}
+
+	counter, ok := validateTOTP(secret, code, 0)
+	if !ok {
+		return nil, ErrorInvalidSecondFactor
+	}
+
+	user.TOTPSecret = secret
+	user.TOTPPendingSecret = ""
+	user.TOTPEnabled = true
+	user.TOTPLastCounter = counter
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Select("totp_secret", "totp_pending_secret", "totp_enabled", "totp_last_counter").Updates(user).Error
+		if err != nil {
+			return err
+		}
+
+		codes, err = user.GenerateRecoveryCodes(tx)
+		return err
+	})
+
+	return codes, err
+}
+
+// DisableTOTP removes the TOTP secret and all recovery codes
+func (user *User) DisableTOTP(db *gorm.DB) error {
+	user.TOTPSecret = ""
+	user.TOTPPendingSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastCounter = 0
+
+	err := db.Model(user).Select("totp_secret", "totp_pending_secret", "totp_enabled", "totp_last_counter").Updates(user).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Unscoped().Where(&RecoveryCode{UserID: user.ID}).Delete(&RecoveryCode{}).Error
+}
+
+// VerifySecondFactor checks code against the users TOTP secret or
+// a recovery code. Used codes can't be used again
+func (user *User) VerifySecondFactor(db *gorm.DB, code string) error {
+	if len(code) == 0 {
+		return ErrorSecondFactorRequired
+	}
+
+	// Try TOTP first
+	if counter, ok := validateTOTP(user.TOTPSecret, code, user.TOTPLastCounter); ok {
+		user.TOTPLastCounter = counter
+		return db.Model(user).Update("totp_last_counter", counter).Error
+	}
+
+	// Try recovery codes. Consume the code if it exists
+	res := db.Unscoped().Where(&RecoveryCode{
+		UserID: user.ID,
+		Hash:   hashRecoveryCode(code),
+	}).Delete(&RecoveryCode{})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrorInvalidSecondFactor
+	}
+
+	return nil
+}
+
+// GenerateRecoveryCodes replaces all recovery codes of user
+func (user *User) GenerateRecoveryCodes(db *gorm.DB) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]RecoveryCode, recoveryCodeCount)
+
+	for i := range codes {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = code
+		hashes[i] = RecoveryCode{
+			UserID: user.ID,
+			Hash:   hashRecoveryCode(code),
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where(&RecoveryCode{UserID: user.ID}).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&hashes).Error
+	})
+
+	return codes, err
+}
+
+// TOTPProvisioningURI returns the otpauth URI which
+// can be rendered as QR code for authenticator apps
+func TOTPProvisioningURI(issuer, username, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totpDigits))
+	values.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// Validate a TOTP code for secret allowing a small clock skew.
+// Codes of counters <= lastCounter are rejected to prevent replays
+func validateTOTP(secret, code string, lastCounter int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(key) == 0 || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := time.Now().Unix() / totpPeriod
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+
+	return 0, false
+}
+
+// Calculate the TOTP code for key at counter (RFC 4226)
+func totpCode(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// Generate a random, human readable recovery code
+func randomRecoveryCode() (string, error) {
+	buff := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(buff); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, recoveryCodeLength)
+	for i := range buff {
+		code[i] = recoveryCodeChars[int(buff[i])%len(recoveryCodeChars)]
+	}
+
+	half := recoveryCodeLength / 2
+	return string(code[:half]) + "-" + string(code[half:]), nil
+}
+
+// Hash a recovery code ignoring casing and separators
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
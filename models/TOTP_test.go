@@ -0,0 +1,129 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors of RFC 6238 appendix B for SHA1. The
+	// codes are truncated to the last six of the eight digits
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		if code := totpCode(key, test.time/totpPeriod); code != test.code {
+			t.Errorf("time %d: expected %s, got %s", test.time, test.code, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+
+	tests := []struct {
+		name   string
+		offset int64
+		used   bool // the current step was used already
+		valid  bool
+	}{
+		{"current", 0, false, true},
+		{"previous step", -1, false, true},
+		{"next step", 1, false, true},
+		{"two steps back", -2, false, false},
+		{"two steps ahead", 2, false, false},
+		{"replayed", 0, true, false},
+		{"previous step after used", -1, true, false},
+		{"next step after used", 1, true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Repeat if the period changed while validating
+			for {
+				current := time.Now().Unix() / totpPeriod
+				counter := current + test.offset
+
+				var lastCounter int64
+				if test.used {
+					lastCounter = current
+				}
+
+				got, ok := validateTOTP(secret, totpCode(key, counter), lastCounter)
+				if current != time.Now().Unix()/totpPeriod {
+					continue
+				}
+
+				if ok != test.valid {
+					t.Fatalf("expected valid %v, got %v", test.valid, ok)
+				}
+				if ok && got != counter {
+					t.Fatalf("expected counter %d, got %d", counter, got)
+				}
+				return
+			}
+		})
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := validateTOTP(secret, code, 0); ok {
+			t.Errorf("invalid code %q accepted", code)
+		}
+	}
+	if _, ok := validateTOTP("not base32!", "123456", 0); ok {
+		t.Error("code for invalid secret accepted")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	db := newTestDB(t, &Config{})
+
+	user := User{Username: "user", RoleID: 1}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	codes, err := user.GenerateRecoveryCodes(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", recoveryCodeCount, len(codes))
+	}
+
+	if err = user.VerifySecondFactor(db, codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = user.VerifySecondFactor(db, codes[0]); err != ErrorInvalidSecondFactor {
+		t.Fatalf("reused code: expected %v, got %v", ErrorInvalidSecondFactor, err)
+	}
+
+	// Casing and separators are ignored
+	if err = user.VerifySecondFactor(db, strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))); err != nil {
+		t.Fatal(err)
+	}
+	if err = user.VerifySecondFactor(db, codes[1]); err != ErrorInvalidSecondFactor {
+		t.Fatalf("reused code: expected %v, got %v", ErrorInvalidSecondFactor, err)
+	}
+
+	// Regenerating invalidates the old codes
+	if _, err = user.GenerateRecoveryCodes(db); err != nil {
+		t.Fatal(err)
+	}
+	if err = user.VerifySecondFactor(db, codes[2]); err != ErrorInvalidSecondFactor {
+		t.Fatalf("replaced code: expected %v, got %v", ErrorInvalidSecondFactor, err)
+	}
+}
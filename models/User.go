@@ -4,13 +4,20 @@ import (
 	"errors"
 	"strings"
 
-	"github.com/JojiiOfficial/gaw"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
-// ErrorUserAlreadyExists error if user exists
-var ErrorUserAlreadyExists = errors.New("user already exists")
+var (
+	// ErrorUserAlreadyExists error if user exists
+	ErrorUserAlreadyExists = errors.New("user already exists")
+
+	// ErrorInvalidCredentials error if the password doesn't match
+	ErrorInvalidCredentials = errors.New("invalid credentials")
+
+	// ErrorUserDisabled error if a disabled user tries to login
+	ErrorUserDisabled = errors.New("user disabled")
+)
 
 // User user in db
 type User struct {
@@ -19,27 +26,115 @@ type User struct {
 	Password string
 	RoleID   uint  `sql:"index"`
 	Role     *Role `gorm:"association_autoupdate:false;association_autocreate:false"`
+	Disabled bool  `gorm:"default:false"`
+
+	// Empty for local users
+	AuthSource string
+	ExternalID string
+
+	TOTPSecret        string
+	TOTPPendingSecret string
+	TOTPEnabled       bool `gorm:"default:false"`
+	TOTPLastCounter   int64
+}
+
+// Authenticate verifies the users credentials and loads the
+// user. user.Password has to contain the plaintext password
+// which will be verified against the stored hash
+func (user *User) Authenticate(db *gorm.DB, config *Config) error {
+	password := user.Password
+	has, err := user.Has(db)
+
+	// Users unknown locally might exist in the directory
+	if !has && err == gorm.ErrRecordNotFound && config.Server.LDAP.Enabled {
+		user.ID = 0
+		return user.authenticateLDAP(db, config, password)
+	}
+
+	// Return if user not exists
+	if !has {
+		// Hash anyway to prevent user enumeration by timing
+		HashPassword(password, config)
+		return err
+	}
+
+	if user.AuthSource == AuthSourceLDAP {
+		if !config.Server.LDAP.Enabled {
+			return ErrorInvalidCredentials
+		}
+
+		if err := user.authenticateLDAP(db, config, password); err != nil {
+			return err
+		}
+
+		if user.Disabled {
+			return ErrorUserDisabled
+		}
+
+		return nil
+	}
+
+	// Other external users can't login with a password
+	if user.IsExternal() {
+		HashPassword(password, config)
+		return ErrorInvalidCredentials
+	}
+
+	// Verify password
+	valid, needsRehash := user.CheckPassword(password, config)
+	if !valid {
+		return ErrorInvalidCredentials
+	}
+
+	if user.Disabled {
+		return ErrorUserDisabled
+	}
+
+	// Upgrade legacy or outdated hashes
+	if needsRehash {
+		if err := user.UpdatePassword(db, password, config); err != nil {
+			logrus.Error(err)
+		} else {
+			logrus.Infof("Upgraded password hash of user '%s'", user.Username)
+		}
+	}
+
+	return nil
 }
 
-// Login login user
-func (user *User) Login(db *gorm.DB, machineID string) (*LoginSession, error) {
+// Login login user. Requires otp to be a valid
+// TOTP or recovery code if the user enabled 2FA
+func (user *User) Login(db *gorm.DB, config *Config, machineID, otp, ip string) (*LoginSession, error) {
 	// Truncat machineID if too big
 	if len(machineID) > 100 {
 		machineID = ""
 	}
 
-	// Return if user not exists
-	if has, err := user.Has(db, true); !has {
+	if err := user.Authenticate(db, config); err != nil {
 		return nil, err
 	}
 
+	// Check second factor
+	if user.HasTOTP() {
+		if err := user.VerifySecondFactor(db, otp); err != nil {
+			return nil, err
+		}
+	} else if user.RequiresTOTP() {
+		return nil, ErrorSecondFactorEnrollment
+	}
+
+	return user.createSession(db, machineID, ip)
+}
+
+// Create a new session for an authenticated user
+func (user *User) createSession(db *gorm.DB, machineID, ip string) (*LoginSession, error) {
 	// Clean old sessions for user + machineID
 	if err := user.cleanOldSessions(db, machineID); err != nil {
 		logrus.Error(err)
 	}
 
 	// Generate session
-	session := NewSession(user, machineID)
+	session := NewSession(user, machineID, ip)
 	if session == nil {
 		return nil, errors.New("Can't generate session")
 	}
@@ -57,29 +152,68 @@ func (user *User) cleanOldSessions(db *gorm.DB, machineID string) error {
 		return nil
 	}
 
-	// Delete session(s)
-	return db.Unscoped().Where(&LoginSession{
+	// Find session(s)
+	var sessions []LoginSession
+	err := db.Where(&LoginSession{
 		UserID:    user.ID,
 		MachineID: machineID,
-	}).Delete(&LoginSession{}).Error
+	}).Find(&sessions).Error
+	if err != nil {
+		return err
+	}
+
+	// Revoke session(s)
+	for i := range sessions {
+		if err := sessions[i].Revoke(db); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Register register user
 func (user User) Register(db *gorm.DB, config *Config) error {
 	// Return if user already exists
-	has, _ := user.Has(db, false)
+	has, _ := user.Has(db)
 	if has {
 		return ErrorUserAlreadyExists
 	}
 
+	// Names of directory users are reserved
+	if has, err := config.HasLDAPUser(user.GetUsername()); has || err != nil {
+		if err != nil {
+			return err
+		}
+
+		return ErrorUserAlreadyExists
+	}
+
+	// Use the default role if none was set
+	roleID := user.RoleID
+	if roleID == 0 {
+		roleID = config.Server.Roles.DefaultRole
+	}
+
+	role, err := FindRole(db, roleID)
+	if err != nil {
+		return err
+	}
+
+	password := user.Password
 	user = User{
-		Password: gaw.SHA512(user.GetUsername() + user.Password),
 		Username: user.GetUsername(),
-		RoleID:   config.GetDefaultRole().ID,
-		Role:     config.GetDefaultRole(),
+		RoleID:   role.ID,
+		Role:     role,
 	}
 
-	err := db.Create(&user).Error
+	// Hash password
+	err = user.SetPassword(password, config)
+	if err != nil {
+		return err
+	}
+
+	err = db.Create(&user).Error
 	if err != nil {
 		return err
 	}
@@ -89,24 +223,342 @@ func (user User) Register(db *gorm.DB, config *Config) error {
 	return err
 }
 
-// Has return true if user exists
-func (user *User) Has(db *gorm.DB, checkPass bool) (bool, error) {
-	pass := ""
-	if checkPass {
-		pass = user.Password
+// Create a user managed by an external source
+// including its default namespace
+func (user *User) provision(db *gorm.DB, source string, role *Role) error {
+	user.Username = user.GetUsername()
+	user.Password = ""
+	user.AuthSource = source
+	user.RoleID = role.ID
+	user.Role = role
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		_, err := user.CreateDefaultNamespace(tx)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
+	logrus.Infof("Provisioned %s user '%s' with role '%s'", source, user.Username, role.RoleName)
+	return nil
+}
+
+// Assign role to an external user if it changed
+func (user *User) syncRole(db *gorm.DB, role *Role) error {
+	if user.RoleID == role.ID {
+		return nil
+	}
+
+	logrus.Infof("Changing role of %s user '%s' to '%s'", user.AuthSource, user.Username, role.RoleName)
+	return user.SetRole(db, role)
+}
+
+// Has return true if user exists and loads it into user
+func (user *User) Has(db *gorm.DB) (bool, error) {
 	//Check if user exists
 	if err := db.Where(&User{
-		Username: user.Username,
-		Password: pass,
-	}).First(user).Error; err != nil {
+		Username: user.GetUsername(),
+	}).Preload("Role").First(user).Error; err != nil {
 		return false, err
 	}
 
 	return true, nil
 }
 
+// FindUser finds a user by its username
+func FindUser(db *gorm.DB, username string) (*User, error) {
+	user := User{Username: username}
+	if _, err := user.Has(db); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// FindActiveUser finds a user by its username. Returns
+// ErrorUserDisabled if the user is disabled
+func FindActiveUser(db *gorm.DB, username string) (*User, error) {
+	user, err := FindUser(db, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Disabled {
+		return nil, ErrorUserDisabled
+	}
+
+	return user, nil
+}
+
+// GetAllUsers returns all users including their roles
+func GetAllUsers(db *gorm.DB) ([]User, error) {
+	var users []User
+	return users, db.Preload("Role").Order("id").Find(&users).Error
+}
+
+// SetDisabled disables or enables the user. Disabling a user revokes all
+// of its sessions. Returns ErrorLastAdmin if no enabled admin would be left
+func (user *User) SetDisabled(db *gorm.DB, disabled bool) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if disabled {
+			if err := checkLastAdmin(tx, 0, user.ID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(user).Update("disabled", disabled).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	user.Disabled = disabled
+
+	if disabled {
+		_, err := RevokeUserSessions(db, user.ID, 0)
+		return err
+	}
+
+	return nil
+}
+
+// SetRole assigns role to the user. Returns
+// ErrorLastAdmin if no enabled admin would be left
+func (user *User) SetRole(db *gorm.DB, role *Role) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !role.Permissions.Has(PermissionAdmin) {
+			if err := checkLastAdmin(tx, 0, user.ID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(user).Update("role_id", role.ID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	user.RoleID = role.ID
+	user.Role = role
+
+	// Reload cached sessions to apply the new role
+	sessionCache.invalidateUser(user.ID)
+	return nil
+}
+
+// Rename changes the username and renames all namespaces
+// prefixed with the old username accordingly
+func (user *User) Rename(db *gorm.DB, config *Config, newName string) error {
+	if user.IsExternal() {
+		return ErrorExternalUser
+	}
+
+	newUser := User{Username: newName}
+	if has, _ := newUser.Has(db); has && newUser.ID != user.ID {
+		return ErrorUserAlreadyExists
+	}
+
+	// Names of directory users are reserved
+	if has, err := config.HasLDAPUser(newUser.GetUsername()); has || err != nil {
+		if err != nil {
+			return err
+		}
+
+		return ErrorUserAlreadyExists
+	}
+
+	oldPrefix := user.GetUsername() + "_"
+	newPrefix := newUser.GetUsername() + "_"
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var namespaces []Namespace
+		if err := tx.Where(&Namespace{UserID: user.ID}).Find(&namespaces).Error; err != nil {
+			return err
+		}
+
+		for i := range namespaces {
+			if !strings.HasPrefix(namespaces[i].Name, oldPrefix) {
+				continue
+			}
+
+			newNamespace := newPrefix + strings.TrimPrefix(namespaces[i].Name, oldPrefix)
+			if err := tx.Model(&namespaces[i]).Update("name", newNamespace).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(user).Update("username", newUser.GetUsername()).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Reload cached sessions to apply the new name
+	sessionCache.invalidateUser(user.ID)
+	return nil
+}
+
+// Delete deletes the user including its namespaces, files, attributes and
+// sessions. Files, attributes and webhooks of other users in its namespaces
+// are deleted as well. Files get shredded once the deletion is committed.
+// Returns ErrorLastAdmin if no enabled admin would be left
+func (user *User) Delete(db *gorm.DB, config *Config) error {
+	if _, err := RevokeUserSessions(db, user.ID, 0); err != nil {
+		return err
+	}
+
+	var jobs []*ShredJob
+
+	err := WithChanges(db, func(tx *gorm.DB, changes *ChangeLog) error {
+		if err := checkLastAdmin(tx, 0, user.ID); err != nil {
+			return err
+		}
+
+		var namespaces []Namespace
+		if err := tx.Unscoped().Where("creator = ?", user.ID).Find(&namespaces).Error; err != nil {
+			return err
+		}
+
+		owned := make(map[uint]bool, len(namespaces))
+		for i := range namespaces {
+			owned[namespaces[i].ID] = true
+		}
+
+		// Everything of the user and everything in its namespaces
+		namespaceIDs := tx.Unscoped().Model(&Namespace{}).Select("id").Where("creator = ?", user.ID)
+
+		var files []File
+		if err := tx.Unscoped().Where("uploader = ? OR namespace_id IN (?)", user.ID, namespaceIDs).Find(&files).Error; err != nil {
+			return err
+		}
+
+		var tags []Tag
+		if err := tx.Unscoped().Where("user_id = ? OR namespace_id IN (?)", user.ID, namespaceIDs).Find(&tags).Error; err != nil {
+			return err
+		}
+
+		var groups []Group
+		if err := tx.Unscoped().Where("user_id = ? OR namespace_id IN (?)", user.ID, namespaceIDs).Find(&groups).Error; err != nil {
+			return err
+		}
+
+		fileIDs := make([]uint, len(files))
+		for i := range files {
+			fileIDs[i] = files[i].ID
+		}
+		tagIDs := make([]uint, len(tags))
+		for i := range tags {
+			tagIDs[i] = tags[i].ID
+		}
+		groupIDs := make([]uint, len(groups))
+		for i := range groups {
+			groupIDs[i] = groups[i].ID
+		}
+
+		// Delete files and attributes including their relations
+		if len(fileIDs) > 0 {
+			if err := tx.Exec("DELETE FROM files_tags WHERE file_id IN (?)", fileIDs).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM files_groups WHERE file_id IN (?)", fileIDs).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Delete(&File{}, fileIDs).Error; err != nil {
+				return err
+			}
+		}
+		if len(tagIDs) > 0 {
+			if err := tx.Exec("DELETE FROM files_tags WHERE tag_id IN (?)", tagIDs).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Delete(&Tag{}, tagIDs).Error; err != nil {
+				return err
+			}
+		}
+		if len(groupIDs) > 0 {
+			if err := tx.Exec("DELETE FROM files_groups WHERE group_id IN (?)", groupIDs).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Delete(&Group{}, groupIDs).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := DeleteWebhooks(tx, "user_id = ? OR namespace_id IN (?)", user.ID, namespaceIDs); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("creator = ?", user.ID).Delete(&Namespace{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where(&RecoveryCode{UserID: user.ID}).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where(&Invite{CreatorID: user.ID}).Delete(&Invite{}).Error; err != nil {
+			return err
+		}
+
+		// Deleted files weren't shredded yet
+		for i := range files {
+			if files[i].DeletedAt.Valid {
+				continue
+			}
+
+			job := &ShredJob{
+				LocalFile: config.GetStorageFile(files[i].LocalName),
+				Size:      files[i].FileSize,
+			}
+			if err := tx.Create(job).Error; err != nil {
+				return err
+			}
+
+			jobs = append(jobs, job)
+		}
+
+		// Report deletions to the owners of other namespaces
+		for i := range files {
+			if !owned[files[i].NamespaceID] && !files[i].DeletedAt.Valid {
+				if err := changes.Record(files[i].NamespaceID, ChangeFile, ChangeDeleted, files[i].ID, files[i].Name); err != nil {
+					return err
+				}
+			}
+		}
+		for i := range tags {
+			if !owned[tags[i].NamespaceID] && !tags[i].DeletedAt.Valid {
+				if err := changes.Record(tags[i].NamespaceID, ChangeTag, ChangeDeleted, tags[i].ID, tags[i].Name); err != nil {
+					return err
+				}
+			}
+		}
+		for i := range groups {
+			if !owned[groups[i].NamespaceID] && !groups[i].DeletedAt.Valid {
+				if err := changes.Record(groups[i].NamespaceID, ChangeGroup, ChangeDeleted, groups[i].ID, groups[i].Name); err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Unscoped().Delete(user).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Shredder files in background
+	for i := range jobs {
+		runShredJob(db, jobs[i])
+	}
+
+	return nil
+}
+
 // GetUsername Gets username of user
 func (user *User) GetUsername() string {
 	return strings.ToLower(user.Username)
@@ -133,12 +585,17 @@ func (user *User) CreateDefaultNamespace(db *gorm.DB) (*Namespace, error) {
 	return &namespace, nil
 }
 
-// HasAccess return true if user has access to the given namespace
+// HasAccess return true if user has write access to the given namespace
 func (user *User) HasAccess(namespace *Namespace) bool {
 	// User has access if it's his namespace or if he can write others
 	return namespace.IsOwnedBy(user) || user.CanWriteForeignNamespace()
 }
 
+// HasReadAccess return true if user can read the given namespace
+func (user *User) HasReadAccess(namespace *Namespace) bool {
+	return namespace.IsOwnedBy(user) || user.CanReadForeignNamespace()
+}
+
 // GetNamespaceName gets the namespace for an user
 func (user *User) GetNamespaceName(namespace string) string {
 	if strings.HasPrefix(namespace, user.GetUsername()+"_") {
@@ -181,10 +638,11 @@ func (user *User) GetFileCount(db *gorm.DB) (int64, error) {
 func (user *User) GetTotalFilesize(db *gorm.DB) (int64, error) {
 	var c int64
 
-	rows, err := db.Debug().Table("files").Select("sum(file_size)").Where(&File{UserID: user.ID}).Where("deleted_at is NULL").Rows()
+	rows, err := db.Table("files").Select("COALESCE(sum(file_size), 0)").Where(&File{UserID: user.ID}).Where("deleted_at is NULL").Rows()
 	if err != nil {
 		return 0, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		err := rows.Scan(&c)
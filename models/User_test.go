@@ -0,0 +1,95 @@
+package models
+
+import (
+	"os"
+	"testing"
+)
+
+func TestUserDelete(t *testing.T) {
+	config := &Config{}
+	config.Server.PathConfig.FileStore = t.TempDir()
+	db := newTestDB(t, config)
+
+	alice := User{Username: "alice", RoleID: 2}
+	bob := User{Username: "bob", RoleID: 1}
+	for _, user := range []*User{&alice, &bob} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aliceNS := Namespace{Name: "alice_default", UserID: alice.ID}
+	bobNS := Namespace{Name: "bob_default", UserID: bob.ID}
+	for _, namespace := range []*Namespace{&aliceNS, &bobNS} {
+		if err := db.Create(namespace).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Files of bob, in bobs namespace and of
+	// alice, which is kept, in her own namespace
+	files := []File{
+		{Name: "own", LocalName: "own", UserID: bob.ID, NamespaceID: bobNS.ID},
+		{Name: "foreign", LocalName: "foreign", UserID: bob.ID, NamespaceID: aliceNS.ID},
+		{Name: "in-bobs", LocalName: "in-bobs", UserID: alice.ID, NamespaceID: bobNS.ID},
+		{Name: "kept", LocalName: "kept", UserID: alice.ID, NamespaceID: aliceNS.ID},
+	}
+	for i := range files {
+		if err := os.WriteFile(config.GetStorageFile(files[i].LocalName), []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Create(&files[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tag := Tag{Name: "bobs", UserID: bob.ID, NamespaceID: aliceNS.ID}
+	webhook := Webhook{UserID: alice.ID, NamespaceID: bobNS.ID, URL: "https://example.com", Secret: "secret"}
+	if err := db.Create(&tag).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&webhook).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bob.Delete(db, config); err != nil {
+		t.Fatal(err)
+	}
+	shredJobs.Wait()
+
+	var remaining []File
+	if err := db.Unscoped().Find(&remaining).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 1 || remaining[0].Name != "kept" {
+		t.Errorf("remaining files %+v", remaining)
+	}
+
+	for _, file := range files[:3] {
+		if _, err := os.Stat(config.GetStorageFile(file.LocalName)); !os.IsNotExist(err) {
+			t.Errorf("file '%s' wasn't shredded: %v", file.Name, err)
+		}
+	}
+
+	var count int64
+	if db.Unscoped().Model(&Tag{}).Count(&count); count != 0 {
+		t.Errorf("%d tags of bob left", count)
+	}
+	if db.Unscoped().Model(&Webhook{}).Count(&count); count != 0 {
+		t.Errorf("%d webhooks in bobs namespace left", count)
+	}
+	if db.Unscoped().Model(&ShredJob{}).Count(&count); count != 0 {
+		t.Errorf("%d shred jobs left", count)
+	}
+
+	// Alice sees the deletions in her namespace
+	changes, err := GetChanges(db, alice.ID, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 2 || changes[0].TargetID != files[1].ID || changes[1].Kind != ChangeTag {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+}
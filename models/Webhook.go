@@ -0,0 +1,441 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	libdm "github.com/DataManager-Go/libdatamanager"
+	"gorm.io/gorm"
+)
+
+// WebhookEvent a file event webhooks can subscribe to
+type WebhookEvent string
+
+// Webhook events
+const (
+	WebhookUploaded  WebhookEvent = "uploaded"
+	WebhookReplaced  WebhookEvent = "replaced"
+	WebhookDeleted   WebhookEvent = "deleted"
+	WebhookPublished WebhookEvent = "published"
+	WebhookTagged    WebhookEvent = "tagged"
+)
+
+// WebhookEvents all webhook events
+var WebhookEvents = []WebhookEvent{WebhookUploaded, WebhookReplaced, WebhookDeleted, WebhookPublished, WebhookTagged}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Length of the random webhook secrets in bytes
+const webhookSecretLength = 32
+
+var (
+	// ErrorWebhookNotFound error if a webhook doesn't exist
+	ErrorWebhookNotFound = errors.New("webhook not found")
+
+	// ErrorInvalidWebhookEvent error if an unknown event was requested
+	ErrorInvalidWebhookEvent = errors.New("invalid webhook event")
+)
+
+// Signals queued deliveries to the delivering service
+var webhookQueued = make(chan struct{}, 1)
+
+// Webhook an URL notified about file events of a namespace.
+// Events contains the subscribed events separated by commas
+type Webhook struct {
+	gorm.Model
+	UserID      uint       `gorm:"index"`
+	User        *User      `gorm:"association_autoupdate:false;association_autocreate:false"`
+	NamespaceID uint       `gorm:"index"`
+	Namespace   *Namespace `gorm:"association_autoupdate:false;association_autocreate:false"`
+	URL         string     `gorm:"not null"`
+	Secret      string     `gorm:"not null"`
+	Events      string
+}
+
+// WebhookDelivery a queued or sent webhook request
+type WebhookDelivery struct {
+	ID           uint      `gorm:"primarykey"`
+	CreatedAt    time.Time `gorm:"index"`
+	WebhookID    uint      `gorm:"index"`
+	Webhook      *Webhook  `gorm:"association_autoupdate:false;association_autocreate:false"`
+	Event        WebhookEvent
+	Payload      string
+	Status       string `gorm:"index"`
+	Attempts     uint
+	NextAttempt  time.Time `gorm:"index"`
+	LastAttempt  time.Time
+	ResponseCode int
+	Error        string
+}
+
+// WebhookPayload the JSON body sent to webhooks
+type WebhookPayload struct {
+	Event     WebhookEvent `json:"event"`
+	Time      time.Time    `json:"time"`
+	Namespace string       `json:"ns"`
+	File      WebhookFile  `json:"file"`
+}
+
+// WebhookFile the file metadata sent to webhooks
+type WebhookFile struct {
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Type       string    `json:"type,omitempty"`
+	Checksum   string    `json:"checksum,omitempty"`
+	Public     bool      `json:"public"`
+	PublicName string    `json:"publicName,omitempty"`
+	Encryption string    `json:"encryption,omitempty"`
+	Tags       []string  `json:"tags"`
+	Groups     []string  `json:"groups"`
+	Created    time.Time `json:"created"`
+}
+
+// ParseWebhookEvents validates events. Returns all events if none were given
+func ParseWebhookEvents(events []string) ([]WebhookEvent, error) {
+	if len(events) == 0 {
+		return WebhookEvents, nil
+	}
+
+	parsed := make([]WebhookEvent, 0, len(events))
+	for _, event := range events {
+		if !isWebhookEvent(WebhookEvent(event)) {
+			return nil, ErrorInvalidWebhookEvent
+		}
+
+		parsed = append(parsed, WebhookEvent(event))
+	}
+
+	return parsed, nil
+}
+
+func isWebhookEvent(event WebhookEvent) bool {
+	for i := range WebhookEvents {
+		if WebhookEvents[i] == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CreateWebhook creates a webhook for events of namespace with a random secret
+func CreateWebhook(db *gorm.DB, user *User, namespace *Namespace, url string, events []WebhookEvent) (*Webhook, error) {
+	secret, err := randomWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := Webhook{
+		UserID:      user.ID,
+		User:        user,
+		NamespaceID: namespace.ID,
+		Namespace:   namespace,
+		URL:         url,
+		Secret:      secret,
+	}
+	webhook.SetEvents(events)
+
+	return &webhook, db.Create(&webhook).Error
+}
+
+// FindWebhook finds a webhook by its ID
+func FindWebhook(db *gorm.DB, id uint) (*Webhook, error) {
+	var webhook Webhook
+	err := db.Preload("Namespace").Preload("User").First(&webhook, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrorWebhookNotFound
+	}
+
+	return &webhook, err
+}
+
+// GetWebhooks returns all webhooks of userID.
+// Returns the webhooks of all users if userID is 0
+func GetWebhooks(db *gorm.DB, userID uint) ([]Webhook, error) {
+	var webhooks []Webhook
+
+	query := db.Preload("Namespace").Preload("User").Order("id")
+	if userID != 0 {
+		query = query.Where(&Webhook{UserID: userID})
+	}
+
+	return webhooks, query.Find(&webhooks).Error
+}
+
+// GetEvents returns the subscribed events
+func (webhook *Webhook) GetEvents() []WebhookEvent {
+	if len(webhook.Events) == 0 {
+		return []WebhookEvent{}
+	}
+
+	split := strings.Split(webhook.Events, ",")
+	events := make([]WebhookEvent, len(split))
+	for i := range split {
+		events[i] = WebhookEvent(split[i])
+	}
+
+	return events
+}
+
+// SetEvents sets the subscribed events
+func (webhook *Webhook) SetEvents(events []WebhookEvent) {
+	split := make([]string, len(events))
+	for i := range events {
+		split[i] = string(events[i])
+	}
+
+	webhook.Events = strings.Join(split, ",")
+}
+
+// HasEvent returns true if the webhook is subscribed to event
+func (webhook *Webhook) HasEvent(event WebhookEvent) bool {
+	for _, e := range webhook.GetEvents() {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RotateSecret replaces the secret with a new random one
+func (webhook *Webhook) RotateSecret() error {
+	secret, err := randomWebhookSecret()
+	if err != nil {
+		return err
+	}
+
+	webhook.Secret = secret
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of payload using the webhooks secret
+func (webhook *Webhook) Sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Save saves the webhook
+func (webhook *Webhook) Save(db *gorm.DB) error {
+	return db.Save(webhook).Error
+}
+
+// Delete deletes the webhook and its deliveries
+func (webhook *Webhook) Delete(db *gorm.DB) error {
+	return DeleteWebhooks(db, Webhook{Model: gorm.Model{ID: webhook.ID}})
+}
+
+// DeleteWebhooks deletes all webhooks matching the
+// condition query and their deliveries
+func DeleteWebhooks(db *gorm.DB, query interface{}, args ...interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		webhookIDs := tx.Unscoped().Model(&Webhook{}).Select("id").Where(query, args...)
+		if err := tx.Where("webhook_id IN (?)", webhookIDs).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where(query, args...).Delete(&Webhook{}).Error
+	})
+}
+
+// TriggerWebhooks queues a delivery of event to all
+// webhooks of the files namespace subscribed to it
+func TriggerWebhooks(db *gorm.DB, config *Config, event WebhookEvent, file *File) error {
+	if !config.Server.Webhooks.Enabled {
+		return nil
+	}
+
+	var webhooks []Webhook
+	err := db.Where(&Webhook{NamespaceID: file.NamespaceID}).Find(&webhooks).Error
+	if err != nil {
+		return err
+	}
+
+	var payload string
+	for i := range webhooks {
+		if !webhooks[i].HasEvent(event) {
+			continue
+		}
+
+		// Build the payload only once
+		if len(payload) == 0 {
+			if payload, err = newWebhookPayload(db, event, file); err != nil {
+				return err
+			}
+		}
+
+		err = db.Create(&WebhookDelivery{
+			WebhookID:   webhooks[i].ID,
+			Event:       event,
+			Payload:     payload,
+			Status:      DeliveryPending,
+			NextAttempt: time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(payload) > 0 {
+		// Wake up the delivering service
+		select {
+		case webhookQueued <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// WebhookQueued returns a channel receiving a value if deliveries were queued
+func WebhookQueued() <-chan struct{} {
+	return webhookQueued
+}
+
+// Encode the payload of event for file
+func newWebhookPayload(db *gorm.DB, event WebhookEvent, file *File) (string, error) {
+	payload := WebhookPayload{
+		Event: event,
+		Time:  time.Now(),
+		File: WebhookFile{
+			ID:         file.ID,
+			Name:       file.Name,
+			Size:       file.FileSize,
+			Type:       file.FileType,
+			Checksum:   file.Checksum,
+			Public:     file.IsPublic,
+			PublicName: file.PublicFilename.String,
+			Tags:       TagArrToStringArr(file.Tags),
+			Groups:     GroupArrToStringArr(file.Groups),
+			Created:    file.CreatedAt,
+		},
+	}
+
+	if file.Encryption.Valid && libdm.EncryptionIValid(file.Encryption.Int32) {
+		payload.File.Encryption = libdm.ChiperToString(file.Encryption.Int32)
+	}
+
+	if file.Namespace != nil {
+		payload.Namespace = file.Namespace.Name
+	} else {
+		names, err := GetNamespaceNames(db, []uint{file.NamespaceID})
+		if err != nil {
+			return "", err
+		}
+
+		payload.Namespace = names[file.NamespaceID]
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// GetDueWebhookDeliveries returns at most limit pending deliveries which
+// should be sent now. Deliveries of the webhooks in exclude are skipped
+func GetDueWebhookDeliveries(db *gorm.DB, limit int, exclude []uint) ([]WebhookDelivery, error) {
+	query := db.Preload("Webhook").
+		Where("status = ? AND next_attempt <= ?", DeliveryPending, time.Now())
+
+	if len(exclude) > 0 {
+		query = query.Where("webhook_id NOT IN (?)", exclude)
+	}
+
+	var deliveries []WebhookDelivery
+	err := query.Order("next_attempt").
+		Limit(limit).
+		Find(&deliveries).Error
+
+	return deliveries, err
+}
+
+// GetWebhookDeliveries returns the newest deliveries of a webhook
+// with an ID lower than beforeID if set
+func GetWebhookDeliveries(db *gorm.DB, webhookID, beforeID uint, limit int) ([]WebhookDelivery, error) {
+	query := db.Where(&WebhookDelivery{WebhookID: webhookID}).Order("id DESC").Limit(limit)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var deliveries []WebhookDelivery
+	return deliveries, query.Find(&deliveries).Error
+}
+
+// Delivered marks the delivery as successfully delivered
+func (delivery *WebhookDelivery) Delivered(db *gorm.DB, responseCode int) error {
+	delivery.Attempts++
+	delivery.LastAttempt = time.Now()
+	delivery.ResponseCode = responseCode
+	delivery.Status = DeliveryDelivered
+	delivery.Error = ""
+
+	return delivery.save(db)
+}
+
+// Failed records a failed attempt and schedules the next one. The
+// delay doubles for each attempt. Gives up after the configured attempts
+func (delivery *WebhookDelivery) Failed(db *gorm.DB, config *Config, responseCode int, reason string) error {
+	webhooks := config.Server.Webhooks
+
+	delivery.Attempts++
+	delivery.LastAttempt = time.Now()
+	delivery.ResponseCode = responseCode
+	delivery.Error = reason
+
+	if delivery.Attempts >= webhooks.MaxAttempts {
+		delivery.Status = DeliveryFailed
+	} else {
+		delay := webhooks.RetryDelay
+		for i := uint(1); i < delivery.Attempts && delay < webhooks.MaxRetryDelay; i++ {
+			delay *= 2
+		}
+		if delay > webhooks.MaxRetryDelay {
+			delay = webhooks.MaxRetryDelay
+		}
+
+		delivery.NextAttempt = delivery.LastAttempt.Add(delay)
+	}
+
+	return delivery.save(db)
+}
+
+func (delivery *WebhookDelivery) save(db *gorm.DB) error {
+	return db.Model(delivery).Select("attempts", "last_attempt", "response_code", "status", "error", "next_attempt").Updates(delivery).Error
+}
+
+// DeleteOldWebhookDeliveries deletes finished deliveries older than the
+// configured retention. Deliveries are kept forever if no retention is set
+func DeleteOldWebhookDeliveries(db *gorm.DB, config *Config) (int64, error) {
+	if config.Server.Webhooks.DeliveryRetention <= 0 {
+		return 0, nil
+	}
+
+	res := db.Where("status <> ? AND created_at < ?", DeliveryPending, time.Now().Add(-config.Server.Webhooks.DeliveryRetention)).Delete(&WebhookDelivery{})
+	return res.RowsAffected, res.Error
+}
+
+// Generate a random secret to sign payloads
+func randomWebhookSecret() (string, error) {
+	buff := make([]byte, webhookSecretLength)
+	if _, err := rand.Read(buff); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buff), nil
+}
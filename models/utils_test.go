@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Create an in memory database with the user and
+// the admin role used as default role of config
+func newTestDB(t *testing.T, config *Config) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each connection would get its own database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		sqlDB.Close()
+	})
+
+	if err = db.AutoMigrate(&Role{}, &User{}, &Namespace{}, &LoginSession{}, &OIDCState{}, &Change{},
+		&Tag{}, &File{}, &Group{}, &RecoveryCode{}, &Invite{}, &Webhook{}, &WebhookDelivery{}, &ShredJob{}); err != nil {
+		t.Fatal(err)
+	}
+
+	roles := []Role{
+		{ID: 1, RoleName: "user", Permissions: PermissionUploadFiles},
+		{ID: 2, RoleName: "admin", Permissions: AllPermissions()},
+	}
+	if err = db.Create(&roles).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	config.Server.Roles.DefaultRole = 1
+	return db
+}
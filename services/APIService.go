@@ -1,7 +1,9 @@
 package services
 
 import (
+	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/DataManager-Go/DataManagerServer/handlers"
@@ -14,19 +16,25 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Time given to aborted uploads to clean up on shutdown
+const uploadAbortTimeout = 5 * time.Second
+
 //APIService the service handling the API
 type APIService struct {
 	router        *mux.Router
 	config        *models.Config
 	HTTPServer    *http.Server
 	HTTPTLSServer *http.Server
+	MetricsServer *http.Server
+	certReloader  *CertReloader
 }
 
 //NewAPIService create new API service
 func NewAPIService(config *models.Config, db *gorm.DB) *APIService {
 	router := handlers.NewRouter(config, db)
 
-	var httpServer, httpsServer *http.Server
+	var httpServer, httpsServer, metricsServer *http.Server
+	var certReloader *CertReloader
 
 	//Init http server
 	if config.Webserver.HTTP.Enabled {
@@ -43,8 +51,14 @@ func NewAPIService(config *models.Config, db *gorm.DB) *APIService {
 
 	//Init https server
 	if config.Webserver.HTTPS.Enabled {
+		var err error
+		if certReloader, err = NewCertReloader(config); err != nil {
+			log.Fatal(err)
+		}
+
 		httpsServer = &http.Server{
 			Handler:      router,
+			TLSConfig:    certReloader.TLSConfig(),
 			Addr:         config.Webserver.HTTPS.ListenAddress,
 			ReadTimeout:  config.Webserver.ReadTimeout,
 			WriteTimeout: config.Webserver.WriteTimeout,
@@ -54,11 +68,31 @@ func NewAPIService(config *models.Config, db *gorm.DB) *APIService {
 		httpsServer.SetKeepAlivesEnabled(false)
 	}
 
+	//Init metrics
+	if config.Webserver.Metrics.Enabled {
+		registerMetrics(db)
+
+		// Serve metrics on their own listener if set
+		if len(config.Webserver.Metrics.ListenAddress) > 0 {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("/metrics", handlers.MetricsHandler(config))
+
+			metricsServer = &http.Server{
+				Handler:      metricsMux,
+				Addr:         config.Webserver.Metrics.ListenAddress,
+				ReadTimeout:  config.Webserver.ReadTimeout,
+				WriteTimeout: config.Webserver.WriteTimeout,
+			}
+		}
+	}
+
 	apiService := &APIService{
 		config:        config,
 		router:        router,
 		HTTPServer:    httpServer,
 		HTTPTLSServer: httpsServer,
+		MetricsServer: metricsServer,
+		certReloader:  certReloader,
 	}
 
 	return apiService
@@ -69,8 +103,10 @@ func (service *APIService) Start() {
 	// Start HTTPS if enabled
 	if service.HTTPTLSServer != nil {
 		log.Infof("Server started TLS on port (%s)\n", service.config.Webserver.HTTPS.ListenAddress)
+		go service.certReloader.Watch()
 		go (func() {
-			if err := service.HTTPTLSServer.ListenAndServeTLS(service.config.Webserver.HTTPS.CertFile, service.config.Webserver.HTTPS.KeyFile); err != nil {
+			// Certificates are served by the certReloader
+			if err := service.HTTPTLSServer.ListenAndServeTLS("", ""); err != nil {
 				if err != http.ErrServerClosed {
 					log.Fatal(err)
 				}
@@ -89,4 +125,55 @@ func (service *APIService) Start() {
 			}
 		})()
 	}
+
+	// Start metrics listener if enabled
+	if service.MetricsServer != nil {
+		log.Infof("Metrics server started on (%s)\n", service.config.Webserver.Metrics.ListenAddress)
+		go (func() {
+			if err := service.MetricsServer.ListenAndServe(); err != nil {
+				if err != http.ErrServerClosed {
+					log.Fatal(err)
+				}
+			}
+		})()
+	}
+}
+
+// Shutdown stops accepting connections and waits for running requests
+// like uploads until ctx is done. Remaining requests are aborted then
+func (service *APIService) Shutdown(ctx context.Context) {
+	servers := map[string]*http.Server{
+		"HTTP":    service.HTTPServer,
+		"HTTPs":   service.HTTPTLSServer,
+		"Metrics": service.MetricsServer,
+	}
+
+	var wg sync.WaitGroup
+	for name, server := range servers {
+		if server == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, server *http.Server) {
+			defer wg.Done()
+
+			if err := server.Shutdown(ctx); err != nil {
+				log.Warnf("%s server: %s. Aborting remaining requests", name, err)
+				server.Close()
+			}
+
+			log.Infof("%s server shutdown complete", name)
+		}(name, server)
+	}
+
+	wg.Wait()
+
+	// Let aborted uploads remove their partial files
+	uploadCtx, cancel := context.WithTimeout(context.Background(), uploadAbortTimeout)
+	defer cancel()
+
+	if !handlers.WaitForUploads(uploadCtx) {
+		log.Warn("Uploads didn't stop in time")
+	}
 }
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Interval for checking the certificate files for changes
+const certReloadInterval = 10 * time.Second
+
+// CertReloader serves the TLS certificate and client CAs
+// and reloads them if their files change
+type CertReloader struct {
+	config *models.Config
+
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+
+	mx sync.RWMutex
+}
+
+// NewCertReloader create a new CertReloader and load the files
+func NewCertReloader(config *models.Config) (*CertReloader, error) {
+	reloader := &CertReloader{
+		config: config,
+	}
+
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// Files to watch
+func (reloader *CertReloader) files() []string {
+	https := reloader.config.Webserver.HTTPS
+	files := []string{https.CertFile, https.KeyFile}
+	if len(https.ClientCAFile) > 0 {
+		files = append(files, https.ClientCAFile)
+	}
+
+	return files
+}
+
+// Load the certificate and CA files
+func (reloader *CertReloader) load() error {
+	https := reloader.config.Webserver.HTTPS
+
+	// Get modification times first to not miss changes while loading.
+	// Broken files are only retried after they changed again
+	modTimes := make(map[string]time.Time)
+	for _, file := range reloader.files() {
+		stat, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+
+		modTimes[file] = stat.ModTime()
+	}
+
+	reloader.mx.Lock()
+	reloader.modTimes = modTimes
+	reloader.mx.Unlock()
+
+	cert, err := tls.LoadX509KeyPair(https.CertFile, https.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if len(https.ClientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(https.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + https.ClientCAFile)
+		}
+	}
+
+	reloader.mx.Lock()
+	defer reloader.mx.Unlock()
+
+	reloader.cert = &cert
+	reloader.clientCAs = clientCAs
+
+	return nil
+}
+
+// Returns true if one of the files was modified since the last load
+func (reloader *CertReloader) changed() bool {
+	reloader.mx.RLock()
+	defer reloader.mx.RUnlock()
+
+	for file, modTime := range reloader.modTimes {
+		stat, err := os.Stat(file)
+		if err != nil {
+			// Files might be replaced in multiple steps
+			continue
+		}
+
+		if !stat.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Watch the files and reload them on changes. Keeps
+// using the previous files if they can't be loaded
+func (reloader *CertReloader) Watch() {
+	for {
+		time.Sleep(certReloadInterval)
+
+		if !reloader.changed() {
+			continue
+		}
+
+		if err := reloader.load(); err != nil {
+			log.Errorf("Can't reload TLS certificates: %s", err)
+			continue
+		}
+
+		log.Info("Reloaded TLS certificates")
+	}
+}
+
+// TLSConfig returns a TLS config using the current files
+func (reloader *CertReloader) TLSConfig() *tls.Config {
+	clientAuth := tls.VerifyClientCertIfGiven
+	if reloader.config.Webserver.HTTPS.RequireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: reloader.getCertificate,
+	}
+
+	if len(reloader.config.Webserver.HTTPS.ClientCAFile) > 0 {
+		// Create a config per connection to use the current CAs
+		tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			reloader.mx.RLock()
+			defer reloader.mx.RUnlock()
+
+			return &tls.Config{
+				GetCertificate: reloader.getCertificate,
+				ClientCAs:      reloader.clientCAs,
+				ClientAuth:     clientAuth,
+			}, nil
+		}
+	}
+
+	return tlsConfig
+}
+
+func (reloader *CertReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mx.RLock()
+	defer reloader.mx.RUnlock()
+
+	return reloader.cert, nil
+}
@@ -1,9 +1,10 @@
 package services
 
 import (
-	"fmt"
+	"context"
 	"time"
 
+	"github.com/DataManager-Go/DataManagerServer/metrics"
 	"github.com/DataManager-Go/DataManagerServer/models"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -12,49 +13,127 @@ import (
 // CleanupService cleanupservice cleansup stuff in background from DB
 type CleanupService struct {
 	db     *gorm.DB
-	config *models.Config
+	config func() *models.Config
+	done   chan struct{}
 }
 
-// NewClienupService create a new cleanupservice
-func NewClienupService(config *models.Config, db *gorm.DB) *CleanupService {
+// NewClienupService create a new cleanupservice. config
+// returns the current config for each cleanup run
+func NewClienupService(config func() *models.Config, db *gorm.DB) *CleanupService {
 	return &CleanupService{
 		config: config,
 		db:     db,
+		done:   make(chan struct{}),
 	}
 }
 
-// Start starts the service
-func (cs *CleanupService) Start() {
+// Start starts the service until ctx is done
+func (cs *CleanupService) Start(ctx context.Context) {
 	cs.debug()
-	go cs.run()
+	go cs.run(ctx)
 }
 
-func (cs *CleanupService) run() {
+// Wait waits until the service stopped
+func (cs *CleanupService) Wait() {
+	<-cs.done
+}
+
+func (cs *CleanupService) run(ctx context.Context) {
+	defer close(cs.done)
+
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
 	for {
-		cs.deleteUnusedSessions()
-		time.Sleep(1 * time.Hour)
+		cs.deleteExpiredSessions()
+		cs.deleteOldAuditEntries()
+		cs.deleteOldWebhookDeliveries()
+		cs.deleteOldChanges()
+
+		metrics.CleanupRuns.Inc()
+		metrics.CleanupLastRun.SetToCurrentTime()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Deletes unused and expired sessions
+func (cs *CleanupService) deleteExpiredSessions() {
+	deleted, err := models.DeleteExpiredSessions(cs.db, cs.config())
+
+	// Log error
+	if err != nil {
+		log.Error(err)
+		metrics.CleanupErrors.WithLabelValues("sessions").Inc()
+		return
+	}
+
+	metrics.CleanupDeleted.WithLabelValues("sessions").Add(float64(deleted))
+
+	log.Infof("Deleted %d unused or expired sessions", deleted)
+}
+
+// Deletes audit entries older than the retention
+func (cs *CleanupService) deleteOldAuditEntries() {
+	deleted, err := models.DeleteOldAuditEntries(cs.db, cs.config())
+
+	// Log error
+	if err != nil {
+		log.Error(err)
+		metrics.CleanupErrors.WithLabelValues("audit").Inc()
+		return
+	}
+
+	metrics.CleanupDeleted.WithLabelValues("audit").Add(float64(deleted))
+
+	if deleted > 0 {
+		log.Infof("Deleted %d old audit entries", deleted)
 	}
 }
 
-// Deletes unused sessions after in config specified duration
-func (cs *CleanupService) deleteUnusedSessions() {
-	// Delete where requests = 0 and creation > specified allowed time
-	e := cs.db.Unscoped().
-		Where("requests = 0").
-		Where(fmt.Sprintf("created_at < now() - interval '%d seconds'",
-			int(cs.config.Server.DeleteUnusedSessionsAfter.Seconds()))).
-		Delete(&models.LoginSession{})
+// Deletes finished webhook deliveries older than the retention
+func (cs *CleanupService) deleteOldWebhookDeliveries() {
+	deleted, err := models.DeleteOldWebhookDeliveries(cs.db, cs.config())
 
 	// Log error
-	if e.Error != nil {
-		log.Error(e.Error)
+	if err != nil {
+		log.Error(err)
+		metrics.CleanupErrors.WithLabelValues("webhookDeliveries").Inc()
 		return
 	}
 
-	log.Infof("Deleted %d unused sessions", e.RowsAffected)
+	metrics.CleanupDeleted.WithLabelValues("webhookDeliveries").Add(float64(deleted))
+
+	if deleted > 0 {
+		log.Infof("Deleted %d old webhook deliveries", deleted)
+	}
+}
+
+// Deletes changes older than the retention
+func (cs *CleanupService) deleteOldChanges() {
+	deleted, err := models.DeleteOldChanges(cs.db, cs.config())
+
+	// Log error
+	if err != nil {
+		log.Error(err)
+		metrics.CleanupErrors.WithLabelValues("changes").Inc()
+		return
+	}
+
+	metrics.CleanupDeleted.WithLabelValues("changes").Add(float64(deleted))
+
+	if deleted > 0 {
+		log.Infof("Deleted %d old changes", deleted)
+	}
 }
 
 // just debug things
 func (cs *CleanupService) debug() {
-	log.Debugf("Deleting unused sessions after %s", cs.config.Server.DeleteUnusedSessionsAfter.String())
+	config := cs.config()
+	log.Debugf("Deleting unused sessions after %s", config.Server.DeleteUnusedSessionsAfter.String())
+	log.Debugf("Session idle timeout: %s, max lifetime: %s", config.Server.SessionIdleTimeout.String(), config.Server.SessionMaxLifetime.String())
 }
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/metrics"
+	"github.com/DataManager-Go/DataManagerServer/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Storage totals are cached to not query them on every scrape
+const storageMetricsCacheTime = time.Minute
+
+// Collects the storage totals per namespace
+type storageCollector struct {
+	db    *gorm.DB
+	files *prometheus.Desc
+	bytes *prometheus.Desc
+
+	mx      sync.Mutex
+	usage   []models.NamespaceUsage
+	updated time.Time
+}
+
+func newStorageCollector(db *gorm.DB) *storageCollector {
+	labels := []string{"namespace", "owner"}
+
+	return &storageCollector{
+		db:    db,
+		files: metrics.NewDesc("namespace_files", "Files stored in a namespace.", labels),
+		bytes: metrics.NewDesc("namespace_bytes", "Bytes stored in a namespace.", labels),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (collector *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.files
+	ch <- collector.bytes
+}
+
+// Collect implements prometheus.Collector
+func (collector *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.mx.Lock()
+	defer collector.mx.Unlock()
+
+	if time.Since(collector.updated) > storageMetricsCacheTime {
+		usage, err := models.GetNamespaceUsage(collector.db)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		collector.usage = usage
+		collector.updated = time.Now()
+	}
+
+	for _, usage := range collector.usage {
+		ch <- prometheus.MustNewConstMetric(collector.files, prometheus.GaugeValue, float64(usage.FileCount), usage.Name, usage.Owner)
+		ch <- prometheus.MustNewConstMetric(collector.bytes, prometheus.GaugeValue, float64(usage.Size), usage.Name, usage.Owner)
+	}
+}
+
+// Register the collectors requiring the database
+func registerMetrics(db *gorm.DB) {
+	err := prometheus.Register(newStorageCollector(db))
+	if _, ok := err.(prometheus.AlreadyRegisteredError); err != nil && !ok {
+		log.Error(err)
+	}
+}
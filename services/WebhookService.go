@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/DataManager-Go/DataManagerServer/models"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// Interval for checking for due deliveries
+	webhookPollInterval = 10 * time.Second
+
+	// Max deliveries fetched per run
+	webhookBatchSize = 50
+
+	// Max webhooks delivered to at the same time. Deliveries
+	// of a single webhook are sent one after another
+	webhookWorkers = 8
+
+	// Max bytes of a response body read to reuse the connection
+	webhookMaxResponse = 64 * 1024
+)
+
+// ErrWebhookTarget error if a webhook resolves to an internal address
+var ErrWebhookTarget = errors.New("webhook target address not allowed")
+
+// WebhookService delivers queued webhooks in background
+type WebhookService struct {
+	db     *gorm.DB
+	config func() *models.Config
+	client *http.Client
+	done   chan struct{}
+
+	// Webhooks currently delivered to by a worker
+	busy    map[uint]bool
+	busyMx  sync.Mutex
+	workers sync.WaitGroup
+
+	// Receives a value when a worker finished
+	idle chan struct{}
+}
+
+// NewWebhookService create a new webhook service. config
+// returns the current config for each delivery
+func NewWebhookService(config func() *models.Config, db *gorm.DB) *WebhookService {
+	ws := &WebhookService{
+		config: config,
+		db:     db,
+		done:   make(chan struct{}),
+		busy:   make(map[uint]bool),
+		idle:   make(chan struct{}, 1),
+	}
+
+	// Check the resolved address of each connection
+	// so DNS can't point webhooks to internal hosts
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: ws.checkTarget,
+	}
+
+	ws.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        webhookWorkers,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// Don't follow redirects
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return ws
+}
+
+// Start starts the service until ctx is done if webhooks are enabled
+func (ws *WebhookService) Start(ctx context.Context) {
+	if !ws.config().Server.Webhooks.Enabled {
+		close(ws.done)
+		return
+	}
+
+	go ws.run(ctx)
+}
+
+// Wait waits until the service stopped
+func (ws *WebhookService) Wait() {
+	<-ws.done
+}
+
+func (ws *WebhookService) run(ctx context.Context) {
+	defer close(ws.done)
+	defer ws.workers.Wait()
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ws.deliverDue(ctx)
+
+		// Wait for new deliveries, retries or free workers
+		select {
+		case <-ticker.C:
+		case <-models.WebhookQueued():
+		case <-ws.idle:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Start workers sending the due deliveries of webhooks
+// which aren't delivered to by another worker already
+func (ws *WebhookService) deliverDue(ctx context.Context) {
+	ws.busyMx.Lock()
+	defer ws.busyMx.Unlock()
+
+	if len(ws.busy) >= webhookWorkers {
+		return
+	}
+
+	exclude := make([]uint, 0, len(ws.busy))
+	for id := range ws.busy {
+		exclude = append(exclude, id)
+	}
+
+	deliveries, err := models.GetDueWebhookDeliveries(ws.db, webhookBatchSize, exclude)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	// Group the deliveries by their webhook keeping their order
+	var webhooks []uint
+	queues := make(map[uint][]*models.WebhookDelivery)
+	for i := range deliveries {
+		id := deliveries[i].WebhookID
+		if _, ok := queues[id]; !ok {
+			webhooks = append(webhooks, id)
+		}
+
+		queues[id] = append(queues[id], &deliveries[i])
+	}
+
+	for _, id := range webhooks {
+		if len(ws.busy) >= webhookWorkers {
+			return
+		}
+
+		ws.busy[id] = true
+		ws.workers.Add(1)
+		go ws.work(ctx, id, queues[id])
+	}
+}
+
+// Send the deliveries of a webhook one after another
+func (ws *WebhookService) work(ctx context.Context, webhookID uint, queue []*models.WebhookDelivery) {
+	defer ws.workers.Done()
+
+	for _, delivery := range queue {
+		if ctx.Err() != nil {
+			break
+		}
+
+		ws.deliver(ctx, delivery)
+	}
+
+	ws.busyMx.Lock()
+	delete(ws.busy, webhookID)
+	ws.busyMx.Unlock()
+
+	// Let the service fetch the remaining deliveries
+	select {
+	case ws.idle <- struct{}{}:
+	default:
+	}
+}
+
+// Reject connections to internal addresses
+// which aren't part of the allowed networks
+func (ws *WebhookService) checkTarget(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if !ws.config().IsWebhookTarget(net.ParseIP(host)) {
+		return ErrWebhookTarget
+	}
+
+	return nil
+}
+
+// Send a delivery and record the result
+func (ws *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	code, err := ws.send(ctx, delivery)
+
+	// Deliveries aborted by a shutdown stay pending
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		log.Warnf("Webhook delivery %d failed: %s", delivery.ID, err)
+		err = delivery.Failed(ws.db, ws.config(), code, err.Error())
+	} else {
+		err = delivery.Delivered(ws.db, code)
+	}
+
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// Post the payload of delivery to its webhook.
+// Returns the status code of the response
+func (ws *WebhookService) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	webhook := delivery.Webhook
+	if webhook == nil {
+		return 0, errors.New("webhook not found")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ws.config().Server.Webhooks.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DataManager-Webhook")
+	req.Header.Set("X-DataManager-Event", string(delivery.Event))
+	req.Header.Set("X-DataManager-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-DataManager-Signature", "sha256="+webhook.Sign(delivery.Payload))
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, webhookMaxResponse))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.New("Non 2xx response: " + resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
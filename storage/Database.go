@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/DataManager-Go/DataManagerServer/models"
 	log "github.com/sirupsen/logrus"
@@ -26,7 +27,7 @@ func ConnectToDatabase(config *models.Config) (*gorm.DB, error) {
 			dbFile = "data.db"
 		}
 
-		dialector = sqlite.Open(dbFile)
+		dialector = sqlite.Open(sqliteDSN(dbFile))
 	}
 
 	db, err := gorm.Open(dialector, &gorm.Config{})
@@ -34,6 +35,10 @@ func ConnectToDatabase(config *models.Config) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	// Check for roles which have to be migrated
+	// before adding the permissions column
+	legacyRoles := db.Migrator().HasTable(&models.Role{}) && !db.Migrator().HasColumn(&models.Role{}, "permissions")
+
 	//Automigration
 	err = db.AutoMigrate(
 		&models.Role{},
@@ -43,6 +48,15 @@ func ConnectToDatabase(config *models.Config) (*gorm.DB, error) {
 		&models.Group{},
 		&models.User{},
 		&models.LoginSession{},
+		&models.LoginFailure{},
+		&models.RecoveryCode{},
+		&models.Invite{},
+		&models.OIDCState{},
+		&models.AuditEntry{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.Change{},
+		&models.ShredJob{},
 	)
 
 	//Return error if automigration fails
@@ -50,26 +64,123 @@ func ConnectToDatabase(config *models.Config) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	if legacyRoles {
+		if err = migrateRolePermissions(db); err != nil {
+			return nil, err
+		}
+	}
+
 	createRoles(db, config)
 
 	//Create default namespace
 	return db, nil
 }
 
+// Returns the DSN of the SQLite database dbFile. Changes are applied in
+// transactions along with their change log entries. Most of them read
+// before writing, which fails instead of waiting for other writers
+// in deferred transactions. A configured transaction mode is kept
+func sqliteDSN(dbFile string) string {
+	if strings.Contains(dbFile, "_txlock=") {
+		return dbFile
+	}
+
+	separator := "?"
+	if strings.Contains(dbFile, "?") {
+		separator = "&"
+	}
+
+	return dbFile + separator + "_txlock=immediate"
+}
+
+// Seed the database with the roles specified in the config.
+// Existing roles are managed in the database and won't be updated
 func createRoles(db *gorm.DB, config *models.Config) {
-	//Create in config specified roles
 	for _, role := range config.Server.Roles.Roles {
-		err := db.FirstOrCreate(&role).Error
-		if err != nil {
-			log.Fatalln(err)
+		res := db.FirstOrCreate(&role)
+		if res.Error != nil {
+			log.Fatalln(res.Error)
+		}
+
+		if res.RowsAffected > 0 {
+			log.Infof("Created role '%s'", role.RoleName)
 		}
 	}
+
+	if err := models.SyncRoleSequence(db); err != nil {
+		log.Fatalln(err)
+	}
+
+	if _, err := models.GetDefaultRole(db, config); err != nil {
+		log.Fatalf("Can't find default role %d: %s", config.Server.Roles.DefaultRole, err)
+	}
+}
+
+// Convert the legacy role columns into permissions
+func migrateRolePermissions(db *gorm.DB) error {
+	var roles []struct {
+		ID                     uint
+		IsAdmin                bool
+		AccesForeignNamespaces uint8
+		CreateNamespaces       bool
+		MaxURLcontentSize      int64 `gorm:"column:max_urlcontent_size"`
+		MaxUploadFileSize      int64
+	}
+
+	err := db.Table("roles").Select("id, is_admin, acces_foreign_namespaces, create_namespaces, max_urlcontent_size, max_upload_file_size").Scan(&roles).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, role := range roles {
+			// Previously every role could publish, edit and delete files and
+			// manage attributes. Uploads were disallowed by a size of 0
+			permissions := models.PermissionPublish | models.PermissionEditFiles |
+				models.PermissionDeleteFiles | models.PermissionManageAttributes
+
+			if role.MaxUploadFileSize != 0 {
+				permissions |= models.PermissionUploadFiles
+			}
+			if role.MaxURLcontentSize != 0 {
+				permissions |= models.PermissionUploadURLs
+			}
+			if role.CreateNamespaces {
+				permissions |= models.PermissionCreateNamespaces
+			}
+			if role.AccesForeignNamespaces&1 != 0 {
+				permissions |= models.PermissionReadForeignNamespaces
+			}
+			if role.AccesForeignNamespaces&2 != 0 {
+				permissions |= models.PermissionWriteForeignNamespaces
+			}
+			if role.IsAdmin {
+				permissions |= models.PermissionAdmin
+			}
+
+			if err := tx.Model(&models.Role{}).Where("id = ?", role.ID).Update("permissions", permissions).Error; err != nil {
+				return err
+			}
+
+			log.Infof("Migrated role %d to permissions: %s", role.ID, permissions)
+		}
+
+		// Drop legacy columns
+		for _, column := range []string{"is_admin", "acces_foreign_namespaces", "create_namespaces"} {
+			if err := tx.Migrator().DropColumn(&models.Role{}, column); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 //CheckConnection return true if connected succesfully
 func CheckConnection(db *gorm.DB, config *models.Config) (bool, error) {
 	if config.Server.Database.Type == "sqlite" {
-		return true, nil
+		err := db.Exec("SELECT 1;").Error
+		return err == nil, err
 	}
 
 	err := db.Exec("SELECT version();").Error
@@ -0,0 +1,6 @@
+package storage
+
+import "errors"
+
+// ErrFreeSpaceNotSupported returned by FreeSpace on systems without statfs
+var ErrFreeSpaceNotSupported = errors.New("free space can't be determined on this system")
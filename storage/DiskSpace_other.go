@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package storage
+
+// FreeSpace returns the bytes available to unprivileged users on the filesystem of path
+func FreeSpace(path string) (uint64, error) {
+	return 0, ErrFreeSpaceNotSupported
+}